@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chainSectionPrefix is the prefix of INI sections that define a chain in multi-chain mode: [chain.NAME]
+const chainSectionPrefix = "chain."
+
+// chainKeys are the settings that can be set per chain in multi-chain mode.
+// Settings that are not set for a chain are inherited from the global configuration.
+var chainKeys = map[string]func(cfg *Config, value string) error{
+	"NODE":              func(cfg *Config, value string) error { cfg.Node = value; return nil },
+	"LCDNODE":           func(cfg *Config, value string) error { cfg.LCDNode = value; return nil },
+	"PRIVATEKEY":        func(cfg *Config, value string) error { cfg.PrivateKey = value; return nil },
+	"PUBLICKEY":         func(cfg *Config, value string) error { cfg.PublicKey = value; return nil },
+	"ACCOUNTADDRESS":    func(cfg *Config, value string) error { cfg.AccountAddress = value; return nil },
+	"PRIVATEKEYS":       func(cfg *Config, value string) error { cfg.PrivateKeys = strings.Split(value, ","); return nil },
+	"MNEMONIC":          func(cfg *Config, value string) error { cfg.Mnemonic = value; return nil },
+	"KEYFILE":           func(cfg *Config, value string) error { cfg.KeyFile = value; return nil },
+	"KEYRINGDIR":        func(cfg *Config, value string) error { cfg.KeyringDir = value; return nil },
+	"KEYNAME":           func(cfg *Config, value string) error { cfg.KeyName = value; return nil },
+	"KEYPASSPHRASE":     func(cfg *Config, value string) error { cfg.KeyPassphrase = value; return nil },
+	"REMOTESIGNER":      func(cfg *Config, value string) error { cfg.RemoteSigner = value; return nil },
+	"REMOTESIGNERTOKEN": func(cfg *Config, value string) error { cfg.RemoteSignerToken = value; return nil },
+	"ACCOUNTCOUNT":      func(cfg *Config, value string) error { return parseInt64(&cfg.AccountCount, value) },
+	"AMOUNT":            func(cfg *Config, value string) error { cfg.Amount = value; return nil },
+	"ACCOUNTPREFIX":     func(cfg *Config, value string) error { cfg.AccountPrefix = value; return nil },
+	"TIMEOUT":           func(cfg *Config, value string) error { return parseInt64(&cfg.Timeout, value) },
+	"CLAIMCOOLDOWN":     func(cfg *Config, value string) error { return parseInt64(&cfg.ClaimCooldown, value) },
+	"LEDGERRETENTION":   func(cfg *Config, value string) error { return parseInt64(&cfg.LedgerRetention, value) },
+	"BATCHSIZE":         func(cfg *Config, value string) error { return parseInt64(&cfg.BatchSize, value) },
+	"BATCHWINDOW":       func(cfg *Config, value string) error { return parseInt64(&cfg.BatchWindow, value) },
+	"SEQUENCERETRIES":   func(cfg *Config, value string) error { return parseInt64(&cfg.SequenceRetries, value) },
+	"BROADCASTRETRIES":  func(cfg *Config, value string) error { return parseInt64(&cfg.BroadcastRetries, value) },
+	"GAS":               func(cfg *Config, value string) error { return parseInt64(&cfg.Gas, value) },
+	"GASADJUSTMENT":     func(cfg *Config, value string) error { return parseFloat64(&cfg.GasAdjustment, value) },
+	"GASPRICES":         func(cfg *Config, value string) error { cfg.GasPrices = value; return nil },
+	"FEES":              func(cfg *Config, value string) error { cfg.Fees = value; return nil },
+	"SIMULATE":          func(cfg *Config, value string) error { cfg.Simulate = value == "true"; return nil },
+	"HEALTHINTERVAL":    func(cfg *Config, value string) error { return parseInt64(&cfg.HealthInterval, value) },
+	"ACCOUNTSOURCE":     func(cfg *Config, value string) error { cfg.AccountSource = value; return nil },
+	"CHAINID":           func(cfg *Config, value string) error { cfg.ChainID = value; return nil },
+	"MAXBLOCKAGE":       func(cfg *Config, value string) error { return parseInt64(&cfg.MaxBlockAge, value) },
+	"LOWBALANCE":        func(cfg *Config, value string) error { cfg.LowBalance = value; return nil },
+	"BALANCEINTERVAL":   func(cfg *Config, value string) error { return parseInt64(&cfg.BalanceInterval, value) },
+	"TREASURYKEY":       func(cfg *Config, value string) error { cfg.TreasuryKey = value; return nil },
+	"TREASURYKEYFILE":   func(cfg *Config, value string) error { cfg.TreasuryKeyFile = value; return nil },
+	"TREASURYKEYRING":   func(cfg *Config, value string) error { cfg.TreasuryKeyring = value; return nil },
+	"TREASURYKEYNAME":   func(cfg *Config, value string) error { cfg.TreasuryKeyName = value; return nil },
+	"TREASURYKEYPASS":   func(cfg *Config, value string) error { cfg.TreasuryKeyPass = value; return nil },
+	"TREASURYSIGNER":    func(cfg *Config, value string) error { cfg.TreasurySigner = value; return nil },
+	"TREASURYTOKEN":     func(cfg *Config, value string) error { cfg.TreasuryToken = value; return nil },
+	"REFILLTHRESHOLD":   func(cfg *Config, value string) error { cfg.RefillThreshold = value; return nil },
+	"REFILLAMOUNT":      func(cfg *Config, value string) error { cfg.RefillAmount = value; return nil },
+	"REFILLDAILYCAP":    func(cfg *Config, value string) error { cfg.RefillDailyCap = value; return nil },
+	"BUDGETHOUR":        func(cfg *Config, value string) error { cfg.BudgetHour = value; return nil },
+	"BUDGETDAY":         func(cfg *Config, value string) error { cfg.BudgetDay = value; return nil },
+	"BUDGETCAMPAIGN":    func(cfg *Config, value string) error { cfg.BudgetCampaign = value; return nil },
+	"MAXBALANCE":        func(cfg *Config, value string) error { cfg.MaxBalance = value; return nil },
+	"BALANCECACHE":      func(cfg *Config, value string) error { return parseInt64(&cfg.BalanceCache, value) },
+	"CONVERTVALOPER":    func(cfg *Config, value string) error { cfg.ConvertValoper = value == "true"; return nil },
+	"MODULEACCOUNTS":    func(cfg *Config, value string) error { cfg.ModuleAccounts = strings.Split(value, ","); return nil },
+	"LIMITERRATE":       func(cfg *Config, value string) error { return parseInt64(&cfg.LimiterRate, value) },
+	"LIMITERBURST":      func(cfg *Config, value string) error { return parseInt64(&cfg.LimiterBurst, value) },
+	"RATELIMITS":        func(cfg *Config, value string) error { cfg.RateLimits = value; return nil },
+	"RATELIMITRELOAD":   func(cfg *Config, value string) error { return parseInt64(&cfg.RateLimitReload, value) },
+}
+
+// newChainConfig creates the configuration of a chain, starting from a copy of the global configuration.
+// The wallets are not inherited: every chain needs its own.
+func newChainConfig(global *Config, name string) *Config {
+	chain := *global
+	chain.Name = name
+	chain.Chains = nil
+	chain.PrivateKey = ""
+	chain.PublicKey = ""
+	chain.AccountAddress = ""
+	chain.PrivateKeys = nil
+	chain.Mnemonic = ""
+	chain.KeyFile = ""
+	chain.KeyringDir = ""
+	chain.KeyName = ""
+	chain.KeyPassphrase = ""
+	chain.RemoteSigner = ""
+	chain.RemoteSignerToken = ""
+	chain.TreasuryKey = ""
+	chain.TreasuryKeyFile = ""
+	chain.TreasuryKeyring = ""
+	chain.TreasuryKeyName = ""
+	chain.TreasuryKeyPass = ""
+	chain.TreasurySigner = ""
+	chain.TreasuryToken = ""
+	return &chain
+}
+
+// set changes a per-chain setting.
+func (cfg *Config) set(key string, value string) error {
+	setter, ok := chainKeys[key]
+	if !ok {
+		return fmt.Errorf("setting %s cannot be set per chain (chain %s)", key, cfg.Name)
+	}
+	return setter(cfg, value)
+}
+
+// chainEnvPrefix returns the prefix of the environment variables of a chain: gaia-13003 becomes GAIA_13003_
+func chainEnvPrefix(name string) string {
+	return strings.ToUpper(regexp.MustCompile("[^A-Za-z0-9]").ReplaceAllString(name, "_")) + "_"
+}
+
+func parseInt64(target *int64, value string) (err error) {
+	*target, err = strconv.ParseInt(value, 10, 64)
+	return
+}
+
+func parseFloat64(target *float64, value string) (err error) {
+	*target, err = strconv.ParseFloat(value, 64)
+	return
+}
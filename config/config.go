@@ -10,19 +10,88 @@ import (
 
 // Config holds a complete set of dynamic configuration.
 type Config struct {
-	ApiEnvironment  string   `json:"APIENVIRONMENT"`
-	PrivateKey      string   `json:"PRIVATEKEY"`
-	PublicKey       string   `json:"PUBLICKEY"`
-	AccountAddress  string   `json:"ACCOUNTADDRESS"`
-	Node            string   `json:"NODE"`
-	LCDNode         string   `json:"LCDNODE"`
-	Amount          string   `json:"AMOUNT"`
-	Origins         []string `json:"ORIGINS"`
-	RedisEndpoint   string   `json:"REDISENDPOINT"`
-	RedisPassword   string   `json:"REDISPASSWORD"`
-	RecaptchaSecret string   `json:"RECAPTCHASECRET"`
-	AWSRegion       string   `json:"AWSREGION"`
-	Timeout         int64    `json:"TIMEOUT"`
+	ApiEnvironment    string    `json:"APIENVIRONMENT"`
+	PrivateKey        string    `json:"PRIVATEKEY"`
+	PublicKey         string    `json:"PUBLICKEY"`
+	AccountAddress    string    `json:"ACCOUNTADDRESS"`
+	PrivateKeys       []string  `json:"PRIVATEKEYS"`
+	Mnemonic          string    `json:"MNEMONIC"`
+	KeyFile           string    `json:"KEYFILE"`
+	KeyringDir        string    `json:"KEYRINGDIR"`
+	KeyName           string    `json:"KEYNAME"`
+	KeyPassphrase     string    `json:"KEYPASSPHRASE"`
+	RemoteSigner      string    `json:"REMOTESIGNER"`
+	RemoteSignerToken string    `json:"REMOTESIGNERTOKEN"`
+	AccountCount      int64     `json:"ACCOUNTCOUNT"`
+	Node              string    `json:"NODE"`
+	LCDNode           string    `json:"LCDNODE"`
+	Amount            string    `json:"AMOUNT"`
+	Origins           []string  `json:"ORIGINS"`
+	RedisEndpoint     string    `json:"REDISENDPOINT"`
+	RedisPassword     string    `json:"REDISPASSWORD"`
+	RecaptchaSecret   string    `json:"RECAPTCHASECRET"`
+	AWSRegion         string    `json:"AWSREGION"`
+	Timeout           int64     `json:"TIMEOUT"`
+	LockBackend       string    `json:"LOCKBACKEND"`
+	ClaimCooldown     int64     `json:"CLAIMCOOLDOWN"`
+	LedgerRetention   int64     `json:"LEDGERRETENTION"`
+	BatchSize         int64     `json:"BATCHSIZE"`
+	BatchWindow       int64     `json:"BATCHWINDOW"`
+	AccountPrefix     string    `json:"ACCOUNTPREFIX"`
+	LimiterRate       int64     `json:"LIMITERRATE"`
+	LimiterBurst      int64     `json:"LIMITERBURST"`
+	CaptchaProvider   string    `json:"CAPTCHAPROVIDER"`
+	CaptchaSecret     string    `json:"CAPTCHASECRET"`
+	CaptchaURL        string    `json:"CAPTCHAURL"`
+	CaptchaMinScore   float64   `json:"CAPTCHAMINSCORE"`
+	CaptchaAction     string    `json:"CAPTCHAACTION"`
+	PowSecret         string    `json:"POWSECRET"`
+	PowDifficulty     int64     `json:"POWDIFFICULTY"`
+	PowMaxDifficulty  int64     `json:"POWMAXDIFFICULTY"`
+	PowLoadThreshold  int64     `json:"POWLOADTHRESHOLD"`
+	PowTTL            int64     `json:"POWTTL"`
+	SequenceRetries   int64     `json:"SEQUENCERETRIES"`
+	BroadcastRetries  int64     `json:"BROADCASTRETRIES"`
+	Gas               int64     `json:"GAS"`
+	GasAdjustment     float64   `json:"GASADJUSTMENT"`
+	GasPrices         string    `json:"GASPRICES"`
+	Fees              string    `json:"FEES"`
+	Simulate          bool      `json:"SIMULATE"`
+	HealthInterval    int64     `json:"HEALTHINTERVAL"`
+	AccountSource     string    `json:"ACCOUNTSOURCE"`
+	ChainID           string    `json:"CHAINID"`
+	MaxBlockAge       int64     `json:"MAXBLOCKAGE"`
+	LowBalance        string    `json:"LOWBALANCE"`
+	BalanceInterval   int64     `json:"BALANCEINTERVAL"`
+	AlertWebhook      string    `json:"ALERTWEBHOOK"`
+	AlertSlackWebhook string    `json:"ALERTSLACKWEBHOOK"`
+	AlertSMTPHost     string    `json:"ALERTSMTPHOST"`
+	AlertSMTPUsername string    `json:"ALERTSMTPUSERNAME"`
+	AlertSMTPPassword string    `json:"ALERTSMTPPASSWORD"`
+	AlertSMTPFrom     string    `json:"ALERTSMTPFROM"`
+	AlertSMTPTo       []string  `json:"ALERTSMTPTO"`
+	TreasuryKey       string    `json:"TREASURYKEY"`
+	TreasuryKeyFile   string    `json:"TREASURYKEYFILE"`
+	TreasuryKeyring   string    `json:"TREASURYKEYRING"`
+	TreasuryKeyName   string    `json:"TREASURYKEYNAME"`
+	TreasuryKeyPass   string    `json:"TREASURYKEYPASS"`
+	TreasurySigner    string    `json:"TREASURYSIGNER"`
+	TreasuryToken     string    `json:"TREASURYTOKEN"`
+	RefillThreshold   string    `json:"REFILLTHRESHOLD"`
+	RefillAmount      string    `json:"REFILLAMOUNT"`
+	RefillDailyCap    string    `json:"REFILLDAILYCAP"`
+	BudgetHour        string    `json:"BUDGETHOUR"`
+	BudgetDay         string    `json:"BUDGETDAY"`
+	BudgetCampaign    string    `json:"BUDGETCAMPAIGN"`
+	MaxBalance        string    `json:"MAXBALANCE"`
+	BalanceCache      int64     `json:"BALANCECACHE"`
+	ConvertValoper    bool      `json:"CONVERTVALOPER"`
+	ModuleAccounts    []string  `json:"MODULEACCOUNTS"`
+	TrustedProxies    []string  `json:"TRUSTEDPROXIES"`
+	RateLimits        string    `json:"RATELIMITS"`
+	RateLimitReload   int64     `json:"RATELIMITRELOAD"`
+	Name              string    `json:"NAME"`
+	Chains            []*Config `json:"CHAINS"`
 }
 
 // GetConfigFromFile reads the configuration from an INI-style file and returns a Config struct.
@@ -34,23 +103,105 @@ func GetConfigFromFile(configFile string) (*Config, error) {
 	}
 
 	cfg := Config{
-		ApiEnvironment:  inicfg.Section("").Key("APIENVIRONMENT").String(),
-		PrivateKey:      inicfg.Section("").Key("PRIVATEKEY").String(),
-		PublicKey:       inicfg.Section("").Key("PUBLICKEY").String(),
-		AccountAddress:  inicfg.Section("").Key("ACCOUNTADDRESS").String(),
-		Node:            inicfg.Section("").Key("NODE").String(),
-		LCDNode:         inicfg.Section("").Key("LCDNODE").String(),
-		Amount:          inicfg.Section("").Key("AMOUNT").String(),
-		Origins:         inicfg.Section("").Key("ORIGINS").Strings(","),
-		RedisEndpoint:   inicfg.Section("").Key("REDISENDPOINT").String(),
-		RedisPassword:   inicfg.Section("").Key("REDISPASSWORD").String(),
-		RecaptchaSecret: inicfg.Section("").Key("RECAPTCHASECRET").String(),
-		AWSRegion:       inicfg.Section("").Key("AWSREGION").String(),
+		ApiEnvironment:    inicfg.Section("").Key("APIENVIRONMENT").String(),
+		PrivateKey:        inicfg.Section("").Key("PRIVATEKEY").String(),
+		PublicKey:         inicfg.Section("").Key("PUBLICKEY").String(),
+		AccountAddress:    inicfg.Section("").Key("ACCOUNTADDRESS").String(),
+		PrivateKeys:       inicfg.Section("").Key("PRIVATEKEYS").Strings(","),
+		Mnemonic:          inicfg.Section("").Key("MNEMONIC").String(),
+		KeyFile:           inicfg.Section("").Key("KEYFILE").String(),
+		KeyringDir:        inicfg.Section("").Key("KEYRINGDIR").String(),
+		KeyName:           inicfg.Section("").Key("KEYNAME").String(),
+		KeyPassphrase:     inicfg.Section("").Key("KEYPASSPHRASE").String(),
+		RemoteSigner:      inicfg.Section("").Key("REMOTESIGNER").String(),
+		RemoteSignerToken: inicfg.Section("").Key("REMOTESIGNERTOKEN").String(),
+		Node:              inicfg.Section("").Key("NODE").String(),
+		LCDNode:           inicfg.Section("").Key("LCDNODE").String(),
+		Amount:            inicfg.Section("").Key("AMOUNT").String(),
+		Origins:           inicfg.Section("").Key("ORIGINS").Strings(","),
+		RedisEndpoint:     inicfg.Section("").Key("REDISENDPOINT").String(),
+		RedisPassword:     inicfg.Section("").Key("REDISPASSWORD").String(),
+		RecaptchaSecret:   inicfg.Section("").Key("RECAPTCHASECRET").String(),
+		AWSRegion:         inicfg.Section("").Key("AWSREGION").String(),
+		LockBackend:       inicfg.Section("").Key("LOCKBACKEND").String(),
+		AccountPrefix:     inicfg.Section("").Key("ACCOUNTPREFIX").String(),
+		CaptchaProvider:   inicfg.Section("").Key("CAPTCHAPROVIDER").String(),
+		CaptchaSecret:     inicfg.Section("").Key("CAPTCHASECRET").String(),
+		CaptchaURL:        inicfg.Section("").Key("CAPTCHAURL").String(),
+		CaptchaAction:     inicfg.Section("").Key("CAPTCHAACTION").String(),
+		PowSecret:         inicfg.Section("").Key("POWSECRET").String(),
+		GasPrices:         inicfg.Section("").Key("GASPRICES").String(),
+		Fees:              inicfg.Section("").Key("FEES").String(),
+		AccountSource:     inicfg.Section("").Key("ACCOUNTSOURCE").String(),
+		ChainID:           inicfg.Section("").Key("CHAINID").String(),
+		LowBalance:        inicfg.Section("").Key("LOWBALANCE").String(),
+		AlertWebhook:      inicfg.Section("").Key("ALERTWEBHOOK").String(),
+		AlertSlackWebhook: inicfg.Section("").Key("ALERTSLACKWEBHOOK").String(),
+		AlertSMTPHost:     inicfg.Section("").Key("ALERTSMTPHOST").String(),
+		AlertSMTPUsername: inicfg.Section("").Key("ALERTSMTPUSERNAME").String(),
+		AlertSMTPPassword: inicfg.Section("").Key("ALERTSMTPPASSWORD").String(),
+		AlertSMTPFrom:     inicfg.Section("").Key("ALERTSMTPFROM").String(),
+		AlertSMTPTo:       inicfg.Section("").Key("ALERTSMTPTO").Strings(","),
+		TreasuryKey:       inicfg.Section("").Key("TREASURYKEY").String(),
+		TreasuryKeyFile:   inicfg.Section("").Key("TREASURYKEYFILE").String(),
+		TreasuryKeyring:   inicfg.Section("").Key("TREASURYKEYRING").String(),
+		TreasuryKeyName:   inicfg.Section("").Key("TREASURYKEYNAME").String(),
+		TreasuryKeyPass:   inicfg.Section("").Key("TREASURYKEYPASS").String(),
+		TreasurySigner:    inicfg.Section("").Key("TREASURYSIGNER").String(),
+		TreasuryToken:     inicfg.Section("").Key("TREASURYTOKEN").String(),
+		RefillThreshold:   inicfg.Section("").Key("REFILLTHRESHOLD").String(),
+		RefillAmount:      inicfg.Section("").Key("REFILLAMOUNT").String(),
+		RefillDailyCap:    inicfg.Section("").Key("REFILLDAILYCAP").String(),
+		BudgetHour:        inicfg.Section("").Key("BUDGETHOUR").String(),
+		BudgetDay:         inicfg.Section("").Key("BUDGETDAY").String(),
+		BudgetCampaign:    inicfg.Section("").Key("BUDGETCAMPAIGN").String(),
+		MaxBalance:        inicfg.Section("").Key("MAXBALANCE").String(),
+		ModuleAccounts:    inicfg.Section("").Key("MODULEACCOUNTS").Strings(","),
+		TrustedProxies:    inicfg.Section("").Key("TRUSTEDPROXIES").Strings(","),
+		RateLimits:        inicfg.Section("").Key("RATELIMITS").String(),
 	}
 	cfg.Timeout, err = inicfg.Section("").Key("TIMEOUT").Int64()
 	if err != nil {
 		return nil, err
 	}
+	cfg.AccountCount = inicfg.Section("").Key("ACCOUNTCOUNT").MustInt64(1)
+	cfg.ClaimCooldown = inicfg.Section("").Key("CLAIMCOOLDOWN").MustInt64(0)
+	cfg.LedgerRetention = inicfg.Section("").Key("LEDGERRETENTION").MustInt64(2592000)
+	cfg.BatchSize = inicfg.Section("").Key("BATCHSIZE").MustInt64(1)
+	cfg.BatchWindow = inicfg.Section("").Key("BATCHWINDOW").MustInt64(2000)
+	cfg.SequenceRetries = inicfg.Section("").Key("SEQUENCERETRIES").MustInt64(3)
+	cfg.BroadcastRetries = inicfg.Section("").Key("BROADCASTRETRIES").MustInt64(1)
+	cfg.Gas = inicfg.Section("").Key("GAS").MustInt64(20000)
+	cfg.GasAdjustment = inicfg.Section("").Key("GASADJUSTMENT").MustFloat64(1.2)
+	cfg.Simulate = inicfg.Section("").Key("SIMULATE").MustBool(false)
+	cfg.HealthInterval = inicfg.Section("").Key("HEALTHINTERVAL").MustInt64(30)
+	cfg.MaxBlockAge = inicfg.Section("").Key("MAXBLOCKAGE").MustInt64(0)
+	cfg.BalanceInterval = inicfg.Section("").Key("BALANCEINTERVAL").MustInt64(300)
+	cfg.BalanceCache = inicfg.Section("").Key("BALANCECACHE").MustInt64(30)
+	cfg.ConvertValoper = inicfg.Section("").Key("CONVERTVALOPER").MustBool(false)
+	cfg.LimiterRate = inicfg.Section("").Key("LIMITERRATE").MustInt64(10)
+	cfg.LimiterBurst = inicfg.Section("").Key("LIMITERBURST").MustInt64(0)
+	cfg.RateLimitReload = inicfg.Section("").Key("RATELIMITRELOAD").MustInt64(60)
+	cfg.CaptchaMinScore = inicfg.Section("").Key("CAPTCHAMINSCORE").MustFloat64(0.5)
+	cfg.PowDifficulty = inicfg.Section("").Key("POWDIFFICULTY").MustInt64(20)
+	cfg.PowMaxDifficulty = inicfg.Section("").Key("POWMAXDIFFICULTY").MustInt64(26)
+	cfg.PowLoadThreshold = inicfg.Section("").Key("POWLOADTHRESHOLD").MustInt64(30)
+	cfg.PowTTL = inicfg.Section("").Key("POWTTL").MustInt64(300)
+
+	// [chain.NAME] sections set up multi-chain mode
+	for _, section := range inicfg.Sections() {
+		if !strings.HasPrefix(section.Name(), chainSectionPrefix) {
+			continue
+		}
+		chain := newChainConfig(&cfg, strings.TrimPrefix(section.Name(), chainSectionPrefix))
+		for _, key := range section.Keys() {
+			err = chain.set(key.Name(), key.String())
+			if err != nil {
+				return nil, err
+			}
+		}
+		cfg.Chains = append(cfg.Chains, chain)
+	}
 
 	return &cfg, nil
 }
@@ -58,17 +209,62 @@ func GetConfigFromFile(configFile string) (*Config, error) {
 // GetConfigFromENV reads the configuration from environment variables and returns a Config struct.
 func GetConfigFromENV() (*Config, error) {
 	config := Config{
-		ApiEnvironment:  os.Getenv("APIENVIRONMENT"),
-		PrivateKey:      os.Getenv("PRIVATEKEY"),
-		PublicKey:       os.Getenv("PUBLICKEY"),
-		AccountAddress:  os.Getenv("ACCOUNTADDRESS"),
-		Node:            os.Getenv("NODE"),
-		LCDNode:         os.Getenv("LCDNODE"),
-		Amount:          os.Getenv("AMOUNT"),
-		RedisEndpoint:   os.Getenv("REDISENDPOINT"),
-		RedisPassword:   os.Getenv("REDISPASSWORD"),
-		RecaptchaSecret: os.Getenv("RECAPTCHASECRET"),
-		AWSRegion:       os.Getenv("AWSREGION"),
+		ApiEnvironment:    os.Getenv("APIENVIRONMENT"),
+		PrivateKey:        os.Getenv("PRIVATEKEY"),
+		PublicKey:         os.Getenv("PUBLICKEY"),
+		AccountAddress:    os.Getenv("ACCOUNTADDRESS"),
+		Mnemonic:          os.Getenv("MNEMONIC"),
+		KeyFile:           os.Getenv("KEYFILE"),
+		KeyringDir:        os.Getenv("KEYRINGDIR"),
+		KeyName:           os.Getenv("KEYNAME"),
+		KeyPassphrase:     os.Getenv("KEYPASSPHRASE"),
+		RemoteSigner:      os.Getenv("REMOTESIGNER"),
+		RemoteSignerToken: os.Getenv("REMOTESIGNERTOKEN"),
+		Node:              os.Getenv("NODE"),
+		LCDNode:           os.Getenv("LCDNODE"),
+		Amount:            os.Getenv("AMOUNT"),
+		RedisEndpoint:     os.Getenv("REDISENDPOINT"),
+		RedisPassword:     os.Getenv("REDISPASSWORD"),
+		RecaptchaSecret:   os.Getenv("RECAPTCHASECRET"),
+		AWSRegion:         os.Getenv("AWSREGION"),
+		LockBackend:       os.Getenv("LOCKBACKEND"),
+		AccountPrefix:     os.Getenv("ACCOUNTPREFIX"),
+		CaptchaProvider:   os.Getenv("CAPTCHAPROVIDER"),
+		CaptchaSecret:     os.Getenv("CAPTCHASECRET"),
+		CaptchaURL:        os.Getenv("CAPTCHAURL"),
+		CaptchaAction:     os.Getenv("CAPTCHAACTION"),
+		PowSecret:         os.Getenv("POWSECRET"),
+		GasPrices:         os.Getenv("GASPRICES"),
+		Fees:              os.Getenv("FEES"),
+		AccountSource:     os.Getenv("ACCOUNTSOURCE"),
+		ChainID:           os.Getenv("CHAINID"),
+		LowBalance:        os.Getenv("LOWBALANCE"),
+		AlertWebhook:      os.Getenv("ALERTWEBHOOK"),
+		AlertSlackWebhook: os.Getenv("ALERTSLACKWEBHOOK"),
+		AlertSMTPHost:     os.Getenv("ALERTSMTPHOST"),
+		AlertSMTPUsername: os.Getenv("ALERTSMTPUSERNAME"),
+		AlertSMTPPassword: os.Getenv("ALERTSMTPPASSWORD"),
+		AlertSMTPFrom:     os.Getenv("ALERTSMTPFROM"),
+		AlertSMTPTo:       getEnvList("ALERTSMTPTO"),
+		TreasuryKey:       os.Getenv("TREASURYKEY"),
+		TreasuryKeyFile:   os.Getenv("TREASURYKEYFILE"),
+		TreasuryKeyring:   os.Getenv("TREASURYKEYRING"),
+		TreasuryKeyName:   os.Getenv("TREASURYKEYNAME"),
+		TreasuryKeyPass:   os.Getenv("TREASURYKEYPASS"),
+		TreasurySigner:    os.Getenv("TREASURYSIGNER"),
+		TreasuryToken:     os.Getenv("TREASURYTOKEN"),
+		RefillThreshold:   os.Getenv("REFILLTHRESHOLD"),
+		RefillAmount:      os.Getenv("REFILLAMOUNT"),
+		RefillDailyCap:    os.Getenv("REFILLDAILYCAP"),
+		BudgetHour:        os.Getenv("BUDGETHOUR"),
+		BudgetDay:         os.Getenv("BUDGETDAY"),
+		BudgetCampaign:    os.Getenv("BUDGETCAMPAIGN"),
+		MaxBalance:        os.Getenv("MAXBALANCE"),
+		ModuleAccounts:    getEnvList("MODULEACCOUNTS"),
+		TrustedProxies:    getEnvList("TRUSTEDPROXIES"),
+		RateLimits:        os.Getenv("RATELIMITS"),
+		ConvertValoper:    os.Getenv("CONVERTVALOPER") == "true",
+		Simulate:          os.Getenv("SIMULATE") == "true",
 	}
 
 	timeoutString := os.Getenv("TIMEOUT")
@@ -80,7 +276,136 @@ func GetConfigFromENV() (*Config, error) {
 		return nil, err
 	}
 	config.Timeout = timeout
+	config.AccountCount, err = getEnvInt64("ACCOUNTCOUNT", 1)
+	if err != nil {
+		return nil, err
+	}
+	config.ClaimCooldown, err = getEnvInt64("CLAIMCOOLDOWN", 0)
+	if err != nil {
+		return nil, err
+	}
+	config.LedgerRetention, err = getEnvInt64("LEDGERRETENTION", 2592000)
+	if err != nil {
+		return nil, err
+	}
+	config.BatchSize, err = getEnvInt64("BATCHSIZE", 1)
+	if err != nil {
+		return nil, err
+	}
+	config.BatchWindow, err = getEnvInt64("BATCHWINDOW", 2000)
+	if err != nil {
+		return nil, err
+	}
+	config.SequenceRetries, err = getEnvInt64("SEQUENCERETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+	config.BroadcastRetries, err = getEnvInt64("BROADCASTRETRIES", 1)
+	if err != nil {
+		return nil, err
+	}
+	config.Gas, err = getEnvInt64("GAS", 20000)
+	if err != nil {
+		return nil, err
+	}
+	config.GasAdjustment, err = getEnvFloat64("GASADJUSTMENT", 1.2)
+	if err != nil {
+		return nil, err
+	}
+	config.HealthInterval, err = getEnvInt64("HEALTHINTERVAL", 30)
+	if err != nil {
+		return nil, err
+	}
+	config.MaxBlockAge, err = getEnvInt64("MAXBLOCKAGE", 0)
+	if err != nil {
+		return nil, err
+	}
+	config.BalanceInterval, err = getEnvInt64("BALANCEINTERVAL", 300)
+	if err != nil {
+		return nil, err
+	}
+	config.BalanceCache, err = getEnvInt64("BALANCECACHE", 30)
+	if err != nil {
+		return nil, err
+	}
+	config.LimiterRate, err = getEnvInt64("LIMITERRATE", 10)
+	if err != nil {
+		return nil, err
+	}
+	config.LimiterBurst, err = getEnvInt64("LIMITERBURST", 0)
+	if err != nil {
+		return nil, err
+	}
+	config.RateLimitReload, err = getEnvInt64("RATELIMITRELOAD", 60)
+	if err != nil {
+		return nil, err
+	}
+	config.CaptchaMinScore, err = getEnvFloat64("CAPTCHAMINSCORE", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	config.PowDifficulty, err = getEnvInt64("POWDIFFICULTY", 20)
+	if err != nil {
+		return nil, err
+	}
+	config.PowMaxDifficulty, err = getEnvInt64("POWMAXDIFFICULTY", 26)
+	if err != nil {
+		return nil, err
+	}
+	config.PowLoadThreshold, err = getEnvInt64("POWLOADTHRESHOLD", 30)
+	if err != nil {
+		return nil, err
+	}
+	config.PowTTL, err = getEnvInt64("POWTTL", 300)
+	if err != nil {
+		return nil, err
+	}
 	// parse comma-separated list of origins
 	config.Origins = strings.Split(os.Getenv("ORIGINS"), ",")
+	// parse comma-separated list of additional private keys
+	config.PrivateKeys = getEnvList("PRIVATEKEYS")
+
+	// CHAINS=name1,name2 sets up multi-chain mode, chain settings are read from NAME1_NODE, NAME2_NODE, ...
+	for _, name := range getEnvList("CHAINS") {
+		chain := newChainConfig(&config, name)
+		for key := range chainKeys {
+			value := os.Getenv(chainEnvPrefix(name) + key)
+			if value == "" {
+				continue
+			}
+			err = chain.set(key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		config.Chains = append(config.Chains, chain)
+	}
 	return &config, nil
 }
+
+// getEnvInt64 reads an integer environment variable. It returns defaultValue if the variable is not set.
+func getEnvInt64(name string, defaultValue int64) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// getEnvFloat64 reads a decimal environment variable. It returns defaultValue if the variable is not set.
+func getEnvFloat64(name string, defaultValue float64) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// getEnvList reads a comma-separated list from an environment variable. It returns nil if the variable is not set.
+func getEnvList(name string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
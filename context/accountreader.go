@@ -0,0 +1,149 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// accountStoreName is the name of the store of the auth module on the testnet.
+const accountStoreName = "acc"
+
+// UnknownAccountError is returned by an AccountReader for an account that never received tokens.
+type UnknownAccountError struct {
+	Address string
+}
+
+func (e *UnknownAccountError) Error() string {
+	return fmt.Sprintf("account %s does not exist on the testnet", e.Address)
+}
+
+// AccountReader reads the state of an account (sequence, account number, coins) from the testnet.
+type AccountReader interface {
+	ReadAccount(address sdk.AccAddress) (auth.Account, error)
+}
+
+// NewAccountReader returns the account reader selected by ACCOUNTSOURCE.
+// Without ACCOUNTSOURCE, accounts are read from the LCD node if LCDNODE is set and from the node otherwise.
+func (ctx *Context) NewAccountReader() (AccountReader, error) {
+	source := ctx.Cfg.AccountSource
+	if source == "" {
+		source = defaults.AccountSourceRPC
+		if ctx.Cfg.LCDNode != "" {
+			source = defaults.AccountSourceLCD
+		}
+	}
+
+	switch source {
+	case defaults.AccountSourceLCD:
+		if ctx.Cfg.LCDNode == "" {
+			return nil, errors.New("ACCOUNTSOURCE lcd needs LCDNODE")
+		}
+		return &LCDAccountReader{ctx: ctx}, nil
+	case defaults.AccountSourceRPC:
+		return &RPCAccountReader{ctx: ctx}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown account source %s", ctx.Cfg.AccountSource))
+	}
+}
+
+// LCDAccountReader reads accounts from /accounts/{address} of the LCDNODE endpoints.
+type LCDAccountReader struct {
+	ctx *Context
+}
+
+// ReadAccount implements AccountReader. If the LCD node fails, the next LCDNODE endpoint is asked.
+func (r *LCDAccountReader) ReadAccount(address sdk.AccAddress) (accountDetails auth.Account, err error) {
+	encodedAddress, err := r.ctx.EncodeAddress(address)
+	if err != nil {
+		return
+	}
+
+	// An unknown account is an answer, not a failure of the LCD node
+	var unknown error
+	err = r.ctx.LCDNodes.Do(func(lcdNode string) error {
+		var readErr error
+		accountDetails, readErr = r.readAccount(lcdNode, encodedAddress)
+		if _, ok := readErr.(*UnknownAccountError); ok {
+			unknown = readErr
+			return nil
+		}
+		return readErr
+	})
+	if err == nil && unknown != nil {
+		err = unknown
+	}
+	return
+}
+
+// readAccount reads the details of an account from the LCD node at lcdNode.
+func (r *LCDAccountReader) readAccount(lcdNode string, encodedAddress string) (accountDetails auth.Account, err error) {
+	var httpClient = &http.Client{Timeout: 5 * time.Second}
+	var req *http.Response
+	var rawBody []byte
+
+	req, err = httpClient.Get(fmt.Sprintf("%s/accounts/%s", lcdNode, encodedAddress))
+	if err != nil {
+		return
+	}
+	defer req.Body.Close()
+
+	// An account that never received tokens is answered with no content
+	if req.StatusCode == http.StatusNoContent {
+		err = &UnknownAccountError{Address: encodedAddress}
+		return
+	}
+	if req.StatusCode == http.StatusOK {
+		rawBody, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return
+		}
+	} else {
+		err = errors.New(fmt.Sprintf("http error code %d calling LCD URL", req.StatusCode))
+		return
+	}
+
+	err = r.ctx.Cdc.UnmarshalJSON(rawBody, &accountDetails)
+	return
+}
+
+// RPCAccountReader reads accounts from the auth store of the NODE endpoints with abci_query, so no LCD node is needed.
+type RPCAccountReader struct {
+	ctx *Context
+}
+
+// ReadAccount implements AccountReader. If the node fails, the next NODE endpoint is asked.
+func (r *RPCAccountReader) ReadAccount(address sdk.AccAddress) (accountDetails auth.Account, err error) {
+	var res []byte
+	err = r.ctx.Nodes.Do(func(node string) error {
+		res, err = r.ctx.NodeContext(node).QueryStore(auth.AddressStoreKey(address), accountStoreName)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	// An account that never received tokens is not in the store
+	if len(res) == 0 {
+		return nil, &UnknownAccountError{Address: address.String()}
+	}
+	return r.ctx.CLIContext.AccountDecoder(res)
+}
+
+// GetBalance reads the coins of an address from the testnet with the account reader of the context.
+// An account that does not exist has no coins.
+func (ctx *Context) GetBalance(address sdk.AccAddress) (sdk.Coins, error) {
+	accountDetails, err := ctx.GetAccountDetails(address)
+	if _, ok := err.(*UnknownAccountError); ok {
+		return sdk.Coins{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return accountDetails.GetCoins(), nil
+}
@@ -0,0 +1,90 @@
+package context
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	sdkCtx "github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/cosmos/cosmos-sdk/cmd/gaia/app"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	authcmd "github.com/cosmos/cosmos-sdk/x/auth/client/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newABCIQueryServer stubs a Tendermint RPC node that answers abci_query on the account store with value.
+func newABCIQueryServer(t *testing.T, address sdk.AccAddress, value []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			} `json:"params"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "abci_query", request.Method)
+		assert.Equal(t, fmt.Sprintf("/store/%s/key", accountStoreName), request.Params.Path)
+		assert.Equal(t, strings.ToUpper(hex.EncodeToString(auth.AddressStoreKey(address))), strings.ToUpper(request.Params.Data))
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"%s","result":{"response":{"value":"%s"}}}`, request.ID, base64.StdEncoding.EncodeToString(value))
+	}))
+}
+
+// newRPCAccountReaderContext creates a context that reads accounts from node, set up like InitializeChain does.
+func newRPCAccountReaderContext(node string) *Context {
+	ctx := New()
+	ctx.Cdc = app.MakeCodec()
+	cliContext := sdkCtx.NewCLIContext().
+		WithCodec(ctx.Cdc).
+		WithAccountDecoder(authcmd.GetAccountDecoder(ctx.Cdc))
+	ctx.CLIContext = &cliContext
+	ctx.Nodes = NewEndpointPool("node", []string{node}, ProbeNode)
+	return ctx
+}
+
+func TestRPCAccountReaderDecodesAccount(t *testing.T) {
+	address := sdk.AccAddress(secp256k1.GenPrivKey().PubKey().Address())
+	account := auth.NewBaseAccountWithAddress(address)
+	assert.Nil(t, account.SetCoins(sdk.Coins{sdk.NewInt64Coin("steak", 100)}))
+	assert.Nil(t, account.SetAccountNumber(7))
+	assert.Nil(t, account.SetSequence(3))
+
+	cdc := app.MakeCodec()
+	bz, err := cdc.MarshalBinaryBare(auth.Account(&account))
+	assert.Nil(t, err)
+	node := newABCIQueryServer(t, address, bz)
+	defer node.Close()
+
+	ctx := newRPCAccountReaderContext(node.URL)
+	accountDetails, err := (&RPCAccountReader{ctx: ctx}).ReadAccount(address)
+	if assert.Nil(t, err) {
+		assert.Equal(t, address, accountDetails.GetAddress())
+		assert.Equal(t, int64(7), accountDetails.GetAccountNumber())
+		assert.Equal(t, int64(3), accountDetails.GetSequence())
+		assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 100)}, accountDetails.GetCoins())
+	}
+}
+
+func TestRPCAccountReaderUnknownAccount(t *testing.T) {
+	address := sdk.AccAddress(secp256k1.GenPrivKey().PubKey().Address())
+	node := newABCIQueryServer(t, address, nil)
+	defer node.Close()
+
+	ctx := newRPCAccountReaderContext(node.URL)
+	_, err := (&RPCAccountReader{ctx: ctx}).ReadAccount(address)
+	_, ok := err.(*UnknownAccountError)
+	assert.True(t, ok, "%v", err)
+
+	// An account that does not exist has no coins
+	ctx.AccountReader = &RPCAccountReader{ctx: ctx}
+	coins, err := ctx.GetBalance(address)
+	assert.Nil(t, err)
+	assert.Empty(t, coins)
+}
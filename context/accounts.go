@@ -0,0 +1,371 @@
+package context
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/bartekn/go-bip39"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/hd"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/encoding/amino"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// drainedAccountRecheck is how often the balance of a drained account is read again from the testnet.
+const drainedAccountRecheck = 5 * time.Minute
+
+// lockMargin is added to the expiry of mutexes held across network calls, for the node and LCD queries in between.
+const lockMargin = 30 * time.Second
+
+// AccountErrorFaucetEmpty is the error code of claims that no faucet account can pay for.
+const AccountErrorFaucetEmpty = "faucet_empty"
+
+// accountRand picks the account AcquireAccount starts with, so faucet processes do not all try the same one first.
+var accountRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Account is a faucet wallet that signs and pays for claims.
+// Every account has its own sequence number, account number and broken flag.
+type Account struct {
+	Address sdk.AccAddress
+	PubKey  crypto.PubKey
+	Signer  Signer
+
+	// SequenceMutex stores the current last sequence number of the account on the testnet
+	SequenceMutex Mutex
+	// AccountNumberMutex stores the account number on the testnet for the respective wallet
+	AccountNumberMutex Mutex
+	// BrokenFlagMutex stores if the last execution of the account was successful (tokens were sent)
+	BrokenFlagMutex Mutex
+	// BusyMutex is held by the claim that uses the account, in any faucet process
+	BusyMutex Mutex
+
+	// lockName is added to the mutex names to keep the accounts apart. Empty for the legacy single account.
+	lockName string
+
+	lock           sync.Mutex
+	balance        sdk.Coins
+	balanceKnown   bool
+	balanceChecked time.Time
+}
+
+// newAccount creates an Account that signs with signer. The public key and address come from the signer.
+func newAccount(signer Signer) *Account {
+	address := signer.Address()
+	return &Account{
+		Address:  address,
+		PubKey:   signer.PubKey(),
+		Signer:   signer,
+		lockName: address.String(),
+	}
+}
+
+// LoadAccounts creates the faucet accounts from the configuration: the single PRIVATEKEY account, the PRIVATEKEYS list,
+// ACCOUNTCOUNT accounts derived from MNEMONIC, the KEYFILE key, the KEYNAME key of KEYRINGDIR and the REMOTESIGNER key.
+func (ctx *Context) LoadAccounts() (err error) {
+	ctx.Accounts = nil
+
+	if ctx.Cfg.PrivateKey != "" {
+		var acc *Account
+		acc, err = legacyAccount(ctx.Cfg.PrivateKey, ctx.Cfg.PublicKey, ctx.Cfg.AccountAddress)
+		if err != nil {
+			return
+		}
+		ctx.Accounts = append(ctx.Accounts, acc)
+	}
+
+	for _, privateKeyString := range ctx.Cfg.PrivateKeys {
+		var privKey crypto.PrivKey
+		privKey, err = privKeyFromString(privateKeyString)
+		if err != nil {
+			return
+		}
+		ctx.Accounts = append(ctx.Accounts, newAccount(NewKeySigner(privKey)))
+	}
+
+	if ctx.Cfg.Mnemonic != "" {
+		for i := int64(0); i < ctx.Cfg.AccountCount; i++ {
+			var privKey crypto.PrivKey
+			privKey, err = DerivePrivKey(ctx.Cfg.Mnemonic, uint32(i))
+			if err != nil {
+				return
+			}
+			ctx.Accounts = append(ctx.Accounts, newAccount(NewKeySigner(privKey)))
+		}
+	}
+
+	if ctx.Cfg.KeyFile != "" {
+		var signer Signer
+		signer, err = NewKeyFileSigner(ctx.Cfg.KeyFile, ctx.Cfg.KeyPassphrase)
+		if err != nil {
+			return
+		}
+		ctx.Accounts = append(ctx.Accounts, newAccount(signer))
+	}
+
+	if ctx.Cfg.KeyringDir != "" {
+		var signer Signer
+		signer, err = NewKeyringSigner(ctx.Cfg.KeyringDir, ctx.Cfg.KeyName, ctx.Cfg.KeyPassphrase)
+		if err != nil {
+			return
+		}
+		ctx.Accounts = append(ctx.Accounts, newAccount(signer))
+	}
+
+	if ctx.Cfg.RemoteSigner != "" {
+		var signer Signer
+		signer, err = NewRemoteSigner(ctx.Cfg.RemoteSigner, ctx.Cfg.RemoteSignerToken)
+		if err != nil {
+			return
+		}
+		ctx.Accounts = append(ctx.Accounts, newAccount(signer))
+	}
+
+	if len(ctx.Accounts) == 0 {
+		return errors.New("no faucet account configured, set PRIVATEKEY, PRIVATEKEYS, MNEMONIC, KEYFILE, KEYRINGDIR or REMOTESIGNER")
+	}
+
+	for _, acc := range ctx.Accounts {
+		log.Printf("faucet account %s", acc.Address.String())
+	}
+	return
+}
+
+// legacyAccount creates the account set up with PRIVATEKEY. It keeps the mutex names of single account deployments.
+// The public key and address are derived from the private key, PUBLICKEY and ACCOUNTADDRESS are only checked if set.
+func legacyAccount(privateKeyString string, publicKeyString string, addressString string) (acc *Account, err error) {
+	privKey, err := privKeyFromString(privateKeyString)
+	if err != nil {
+		return
+	}
+	acc = newAccount(NewKeySigner(privKey))
+	acc.lockName = ""
+
+	if publicKeyString != "" {
+		var pubKey crypto.PubKey
+		pubKey, err = sdk.GetAccPubKeyBech32(publicKeyString)
+		if err != nil {
+			return
+		}
+		if !pubKey.Equals(acc.PubKey) {
+			return nil, errors.New("PUBLICKEY does not belong to PRIVATEKEY")
+		}
+	}
+	if addressString != "" {
+		var address sdk.AccAddress
+		address, err = sdk.AccAddressFromBech32(addressString)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(address, acc.Address) {
+			return nil, errors.New("ACCOUNTADDRESS does not belong to PRIVATEKEY")
+		}
+	}
+	return
+}
+
+// privKeyFromString decodes a base64 encoded private key, as extracted by the --extract option.
+func privKeyFromString(privateKeyString string) (crypto.PrivKey, error) {
+	privateKeyBytes, err := base64.StdEncoding.DecodeString(privateKeyString)
+	if err != nil {
+		return nil, err
+	}
+	return cryptoAmino.PrivKeyFromBytes(privateKeyBytes)
+}
+
+// DerivePrivKey derives the private key of the index-th address from a mnemonic,
+// using the same HD path as gaiacli (44'/118'/0'/0/index).
+func DerivePrivKey(mnemonic string, index uint32) (crypto.PrivKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	masterPriv, chainCode := hd.ComputeMastersFromSeed(seed)
+	derivedPriv, err := hd.DerivePrivateKeyForPath(masterPriv, chainCode, hd.NewFundraiserParams(0, index).String())
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.PrivKeySecp256k1(derivedPriv), nil
+}
+
+// SetupAccountMutexes creates the sequence, account number, broken flag and busy mutexes of every account.
+func (ctx *Context) SetupAccountMutexes() (err error) {
+	for _, acc := range ctx.Accounts {
+		err = ctx.setupMutexes(acc)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// sequenceLockExpiry is how long the sequence mutex can be held: V1BroadcastTx waits up to TIMEOUT seconds
+// for each of the 1+BROADCASTRETRIES broadcasts of a transaction.
+func (ctx *Context) sequenceLockExpiry() time.Duration {
+	return time.Duration(ctx.Cfg.Timeout*(1+ctx.Cfg.BroadcastRetries))*time.Second + lockMargin
+}
+
+// setupMutexes creates the sequence, account number, broken flag and busy mutexes of an account.
+// On a testnet reset the caller holds the busy mutex of the account, so no claim uses the mutexes it replaces.
+func (ctx *Context) setupMutexes(acc *Account) (err error) {
+	prefix := ctx.LockPrefix()
+	if acc.lockName != "" {
+		prefix = fmt.Sprintf("%s-%s", prefix, acc.lockName)
+	}
+
+	// The sequence mutex is held while a transaction is broadcast, it must not expire before that
+	sequenceExpiry := ctx.sequenceLockExpiry()
+	sequenceTimeout := sequenceExpiry + 10*time.Second
+	sequence, err := ctx.NewMutex(fmt.Sprintf("%s-sequence", prefix), sequenceExpiry, sequenceTimeout)
+	if err != nil {
+		return
+	}
+
+	accountNumber, err := ctx.NewMutex(fmt.Sprintf("%s-accountnumber", prefix), 1*time.Second, 3*time.Second)
+	if err != nil {
+		return
+	}
+
+	// CheckAndFixAccountDetails holds the broken flag mutex while it reads the account and waits for the sequence mutex
+	brokenFlagExpiry := sequenceTimeout + lockMargin
+	brokenFlag, err := ctx.NewMutex(fmt.Sprintf("%s-brokenflag", prefix), brokenFlagExpiry, brokenFlagExpiry+10*time.Second)
+	if err != nil {
+		return
+	}
+
+	// The busy mutex is held for the whole claim: fixing the account, waiting for the sequence mutex and the broadcast.
+	// If it expires early, the next claim on the account waits for the sequence mutex instead.
+	busy, err := ctx.NewMutex(fmt.Sprintf("%s-busy", prefix), brokenFlagExpiry+sequenceTimeout, 0)
+	if err != nil {
+		return
+	}
+
+	acc.lock.Lock()
+	acc.SequenceMutex, acc.AccountNumberMutex, acc.BrokenFlagMutex, acc.BusyMutex = sequence, accountNumber, brokenFlag, busy
+	acc.lock.Unlock()
+	return
+}
+
+// busyMutex returns the current busy mutex of the account. A testnet reset replaces it.
+func (acc *Account) busyMutex() Mutex {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	return acc.BusyMutex
+}
+
+// tryAcquire takes the busy mutex of the account without waiting. It returns false if the account is busy.
+// The other mutexes of the account are not replaced while it is held.
+func (acc *Account) tryAcquire() bool {
+	busy := acc.busyMutex()
+	if !busy.TryLock() {
+		return false
+	}
+	if busy != acc.busyMutex() {
+		// A testnet reset replaced the mutexes in the meantime
+		busy.Unlock()
+		return false
+	}
+	return true
+}
+
+// release makes the account available again after tryAcquire.
+func (acc *Account) release() {
+	acc.busyMutex().Unlock()
+}
+
+// SetBalance stores the balance of the account as read from the testnet.
+func (acc *Account) SetBalance(coins sdk.Coins) {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	acc.balance = coins
+	acc.balanceKnown = true
+	acc.balanceChecked = time.Now()
+}
+
+// Spend reduces the known balance of the account after a successful transaction.
+func (acc *Account) Spend(coins sdk.Coins) {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	if acc.balanceKnown {
+		acc.balance = acc.balance.Minus(coins)
+	}
+}
+
+// drained tells if the account is known not to have enough balance to pay amount.
+func (acc *Account) drained(amount sdk.Coins) bool {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	return acc.balanceKnown && !acc.balance.IsGTE(amount)
+}
+
+// balanceStale tells if the balance of the account should be read again from the testnet.
+func (acc *Account) balanceStale() bool {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	return time.Since(acc.balanceChecked) > drainedAccountRecheck
+}
+
+// randomAccountIndex returns a random index of a list of n accounts.
+func randomAccountIndex(n int) int {
+	if n == 0 {
+		return 0
+	}
+	accountRand.Lock()
+	defer accountRand.Unlock()
+	return accountRand.Intn(n)
+}
+
+// AcquireAccount picks a faucet account that no faucet process uses and has enough balance to pay amount.
+// Accounts are tried in turn from a random one, drained accounts are skipped. Call ReleaseAccount when done.
+func (ctx *Context) AcquireAccount(amount sdk.Coins) (*Account, error) {
+	deadline := time.Now().Add(time.Duration(ctx.Cfg.Timeout) * time.Second)
+	for {
+		drained := 0
+		start := randomAccountIndex(len(ctx.Accounts))
+		for i := range ctx.Accounts {
+			acc := ctx.Accounts[(start+i)%len(ctx.Accounts)]
+			if acc.drained(amount) && acc.balanceStale() {
+				if err := ctx.RefreshAccountBalance(acc); err != nil {
+					log.Printf("could not refresh balance of %s: %v", acc.Address.String(), err)
+				}
+			}
+			if acc.drained(amount) {
+				drained++
+				continue
+			}
+			if acc.tryAcquire() {
+				return acc, nil
+			}
+		}
+		if drained == len(ctx.Accounts) {
+			return nil, NewError(AccountErrorFaucetEmpty, "the faucet is out of tokens, please try again later")
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("all faucet accounts are busy")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// ReleaseAccount makes an account acquired with AcquireAccount available again.
+func (ctx *Context) ReleaseAccount(acc *Account) {
+	acc.release()
+}
+
+// RefreshAccountBalance reads the balance of an account from the testnet.
+func (ctx *Context) RefreshAccountBalance(acc *Account) error {
+	accountDetails, err := ctx.GetAccountDetails(acc.Address)
+	if err != nil {
+		return err
+	}
+	acc.SetBalance(accountDetails.GetCoins())
+	return nil
+}
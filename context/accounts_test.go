@@ -0,0 +1,95 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"testing"
+	"time"
+)
+
+// newTestAccount creates an account with in-process mutexes.
+func newTestAccount(t *testing.T, ctx *Context) *Account {
+	ctx.Cfg.LockBackend = defaults.LockBackendMemory
+	acc := newAccount(NewKeySigner(secp256k1.GenPrivKey()))
+	assert.Nil(t, ctx.setupMutexes(acc))
+	return acc
+}
+
+func TestAcquireAccountSkipsBusyAndDrainedAccounts(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Timeout = 1
+	amount := sdk.Coins{sdk.NewInt64Coin("steak", 10)}
+
+	drained := newTestAccount(t, ctx)
+	drained.SetBalance(sdk.Coins{sdk.NewInt64Coin("steak", 5)})
+	first := newTestAccount(t, ctx)
+	first.SetBalance(sdk.Coins{sdk.NewInt64Coin("steak", 100)})
+	second := newTestAccount(t, ctx)
+	ctx.Accounts = []*Account{drained, first, second}
+
+	acc1, err := ctx.AcquireAccount(amount)
+	assert.Nil(t, err)
+	acc2, err := ctx.AcquireAccount(amount)
+	assert.Nil(t, err)
+	assert.NotEqual(t, acc1, acc2)
+	assert.NotEqual(t, drained, acc1)
+	assert.NotEqual(t, drained, acc2)
+
+	// Both usable accounts are busy
+	_, err = ctx.AcquireAccount(amount)
+	assert.NotNil(t, err)
+
+	ctx.ReleaseAccount(acc1)
+	acc3, err := ctx.AcquireAccount(amount)
+	assert.Nil(t, err)
+	assert.Equal(t, acc1, acc3)
+}
+
+func TestAcquireAccountSkipsAccountsBusyElsewhere(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Timeout = 1
+	amount := sdk.Coins{sdk.NewInt64Coin("steak", 10)}
+	first := newTestAccount(t, ctx)
+	second := newTestAccount(t, ctx)
+	ctx.Accounts = []*Account{first, second}
+
+	// Another faucet process holds the busy mutex of the first account
+	other := &Account{lockName: first.lockName}
+	assert.Nil(t, ctx.setupMutexes(other))
+	assert.True(t, other.BusyMutex.TryLock())
+
+	for i := 0; i < 5; i++ {
+		acc, err := ctx.AcquireAccount(amount)
+		assert.Nil(t, err)
+		assert.Equal(t, second, acc)
+		ctx.ReleaseAccount(acc)
+	}
+	other.BusyMutex.Unlock()
+}
+
+func TestAcquireAccountFaucetEmpty(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Timeout = 1
+	acc := newTestAccount(t, ctx)
+	acc.SetBalance(sdk.Coins{sdk.NewInt64Coin("steak", 5)})
+	ctx.Accounts = []*Account{acc}
+
+	_, err := ctx.AcquireAccount(sdk.Coins{sdk.NewInt64Coin("steak", 10)})
+	if assert.NotNil(t, err) {
+		e, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.Equal(t, AccountErrorFaucetEmpty, e.Code)
+	}
+}
+
+func TestSequenceLockExpiryCoversBroadcasts(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Timeout = 60
+	ctx.Cfg.BroadcastRetries = 1
+	assert.Equal(t, 150*time.Second, ctx.sequenceLockExpiry())
+
+	ctx.Cfg.BroadcastRetries = 0
+	assert.Equal(t, 90*time.Second, ctx.sequenceLockExpiry())
+}
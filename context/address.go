@@ -0,0 +1,116 @@
+package context
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/tendermint/tendermint/libs/bech32"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+// AddressLength is the length in bytes of account addresses.
+const AddressLength = 20
+
+// AccountPrefix returns the bech32 prefix of account addresses on the testnet: ACCOUNTPREFIX, or the prefix of the SDK.
+func (ctx *Context) AccountPrefix() string {
+	if ctx.Cfg.AccountPrefix != "" {
+		return ctx.Cfg.AccountPrefix
+	}
+	return sdk.Bech32PrefixAccAddr
+}
+
+// ValidatorPrefix returns the bech32 prefix of validator operator addresses on the testnet.
+func (ctx *Context) ValidatorPrefix() string {
+	if ctx.Cfg.AccountPrefix != "" {
+		return ctx.Cfg.AccountPrefix + "valoper"
+	}
+	return sdk.Bech32PrefixValAddr
+}
+
+// ModuleAddress returns the address of a module account, derived from the module name like the SDK does.
+func ModuleAddress(name string) sdk.AccAddress {
+	hash := sha256.Sum256([]byte(name))
+	return sdk.AccAddress(hash[:AddressLength])
+}
+
+// IsModuleAddress tells if an address is a module account of MODULEACCOUNTS (by default, the modules of the SDK).
+func (ctx *Context) IsModuleAddress(address sdk.AccAddress) bool {
+	modules := ctx.Cfg.ModuleAccounts
+	if len(modules) == 0 {
+		modules = defaults.ModuleAccounts
+	}
+	for _, module := range modules {
+		if bytes.Equal(address, ModuleAddress(strings.TrimSpace(module))) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFaucetAddress tells if an address is one of the faucet accounts or the treasury.
+func (ctx *Context) IsFaucetAddress(address sdk.AccAddress) bool {
+	for _, acc := range ctx.Accounts {
+		if bytes.Equal(address, acc.Address) {
+			return true
+		}
+	}
+	return ctx.Treasury != nil && bytes.Equal(address, ctx.Treasury.Address)
+}
+
+// IsHexAddress tells if an address is written in hex with the 0x prefix, like on EVM-compatible testnets.
+func IsHexAddress(address string) bool {
+	return strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X")
+}
+
+// DecodeHexAddress decodes a 0x hex address. If it has both upper and lower case letters, its EIP-55 checksum must match.
+func DecodeHexAddress(address string) (sdk.AccAddress, error) {
+	digits := address[2:]
+	decoded, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, NewError("invalid_address", fmt.Sprintf("address is not hex encoded: %v", err))
+	}
+	if len(decoded) != AddressLength {
+		return nil, NewError("wrong_length", fmt.Sprintf("address must hold %d bytes, not %d", AddressLength, len(decoded)))
+	}
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && digits != checksumHex(decoded) {
+		return nil, NewError("wrong_checksum", "address does not match its EIP-55 checksum")
+	}
+	return sdk.AccAddress(decoded), nil
+}
+
+// HexAddress returns the 0x hex form of an address with the EIP-55 checksum.
+func HexAddress(address sdk.AccAddress) string {
+	return "0x" + checksumHex(address)
+}
+
+// Bech32ToHex returns the 0x hex form of a bech32 address with the EIP-55 checksum.
+func Bech32ToHex(encodedAddress string) (string, error) {
+	_, decoded, err := bech32.DecodeAndConvert(encodedAddress)
+	if err != nil {
+		return "", err
+	}
+	return HexAddress(decoded), nil
+}
+
+// checksumHex writes address in hex, with the letters in upper case where the Keccak-256 hash of the lower case
+// hex has a nibble of 8 or more (EIP-55).
+func checksumHex(address []byte) string {
+	digits := []byte(hex.EncodeToString(address))
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(digits)
+	sum := hash.Sum(nil)
+	for i, digit := range digits {
+		nibble := sum[i/2] >> 4
+		if i%2 == 1 {
+			nibble = sum[i/2] & 0x0f
+		}
+		if digit >= 'a' && nibble >= 8 {
+			digits[i] = digit - 'a' + 'A'
+		}
+	}
+	return string(digits)
+}
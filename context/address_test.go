@@ -0,0 +1,32 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDecodeHexAddress(t *testing.T) {
+	// Examples of EIP-55
+	for _, address := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		decoded, err := DecodeHexAddress(address)
+		assert.Nil(t, err)
+		assert.Equal(t, address, HexAddress(decoded))
+
+		// Addresses in one case have no checksum
+		_, err = DecodeHexAddress(strings.ToLower(address))
+		assert.Nil(t, err)
+	}
+
+	_, err := DecodeHexAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD")
+	assert.Equal(t, "wrong_checksum", err.(*Error).Code)
+	_, err = DecodeHexAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea")
+	assert.Equal(t, "wrong_length", err.(*Error).Code)
+	_, err = DecodeHexAddress("0xnothex")
+	assert.Equal(t, "invalid_address", err.(*Error).Code)
+}
@@ -0,0 +1,147 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// AlertSink delivers alerts, like a low faucet balance, to the operators.
+type AlertSink interface {
+	Alert(subject string, message string) error
+}
+
+// NewAlertSinks returns the alert sinks configured with ALERTWEBHOOK, ALERTSLACKWEBHOOK and ALERTSMTPHOST.
+func (ctx *Context) NewAlertSinks() (sinks []AlertSink) {
+	if ctx.Cfg.AlertWebhook != "" {
+		sinks = append(sinks, NewWebhookSink(ctx.Cfg.AlertWebhook))
+	}
+	if ctx.Cfg.AlertSlackWebhook != "" {
+		sinks = append(sinks, NewSlackSink(ctx.Cfg.AlertSlackWebhook))
+	}
+	if ctx.Cfg.AlertSMTPHost != "" {
+		sinks = append(sinks, NewSMTPSink(ctx.Cfg.AlertSMTPHost, ctx.Cfg.AlertSMTPUsername, ctx.Cfg.AlertSMTPPassword, ctx.Cfg.AlertSMTPFrom, ctx.Cfg.AlertSMTPTo))
+	}
+	return
+}
+
+// SendAlert delivers an alert to all sinks. Failed deliveries are returned together.
+func SendAlert(sinks []AlertSink, subject string, message string) error {
+	var failures []string
+	for _, sink := range sinks {
+		err := sink.Alert(subject, message)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(fmt.Sprintf("could not deliver alert: %s", strings.Join(failures, "; ")))
+	}
+	return nil
+}
+
+// WebhookSink posts alerts as JSON ({"subject":..., "message":...}) to a URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Alert implements AlertSink.
+func (s *WebhookSink) Alert(subject string, message string) error {
+	return postJSON(s.client, s.url, struct {
+		Subject string `json:"subject"`
+		Message string `json:"message"`
+	}{
+		Subject: subject,
+		Message: message,
+	})
+}
+
+// SlackSink posts alerts to a Slack incoming webhook, or any service that accepts the same {"text":...} payload.
+type SlackSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackSink creates a SlackSink.
+func NewSlackSink(url string) *SlackSink {
+	return &SlackSink{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Alert implements AlertSink.
+func (s *SlackSink) Alert(subject string, message string) error {
+	return postJSON(s.client, s.url, struct {
+		Text string `json:"text"`
+	}{
+		Text: fmt.Sprintf("*%s*\n%s", subject, message),
+	})
+}
+
+// postJSON posts payload as JSON and expects a 2xx answer.
+func postJSON(client *http.Client, url string, payload interface{}) error {
+	bz, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	res, err := client.Post(url, "application/json", bytes.NewReader(bz))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("http error code %d calling alert webhook", res.StatusCode))
+	}
+	return nil
+}
+
+// SMTPSink mails alerts. Without a username the mail is sent without authentication.
+type SMTPSink struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPSink creates an SMTPSink that sends through the server at addr (host:port).
+func NewSMTPSink(addr string, username string, password string, from string, to []string) *SMTPSink {
+	return &SMTPSink{
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+// Alert implements AlertSink.
+func (s *SMTPSink) Alert(subject string, message string) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.from, strings.Join(s.to, ", "), subject, message)
+	return smtp.SendMail(s.addr, auth, s.from, s.to, []byte(mail))
+}
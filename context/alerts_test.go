@@ -0,0 +1,94 @@
+package context
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSinks(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload = nil
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	err := NewWebhookSink(server.URL).Alert("faucet balance low", "out of steak")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"subject": "faucet balance low", "message": "out of steak"}, payload)
+
+	err = NewSlackSink(server.URL).Alert("faucet balance low", "out of steak")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"text": "*faucet balance low*\nout of steak"}, payload)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+	err = SendAlert([]AlertSink{NewWebhookSink(server.URL), NewSlackSink(failing.URL)}, "subject", "message")
+	assert.NotNil(t, err)
+}
+
+// serveSMTP answers one SMTP session on listener and sends the received mail to mails.
+func serveSMTP(listener net.Listener, mails chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var mail strings.Builder
+	inData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				mails <- mail.String()
+				reply("250 OK")
+				continue
+			}
+			mail.WriteString(line)
+			continue
+		}
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			inData = true
+			reply("354 go ahead")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	mails := make(chan string, 1)
+	go serveSMTP(listener, mails)
+
+	err = NewSMTPSink(listener.Addr().String(), "", "", "faucet@example.com", []string{"ops@example.com"}).Alert("faucet balance low", "out of steak")
+	assert.Nil(t, err)
+	mail := <-mails
+	assert.Contains(t, mail, "Subject: faucet balance low")
+	assert.Contains(t, mail, "To: ops@example.com")
+	assert.Contains(t, mail, "out of steak")
+}
@@ -0,0 +1,154 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"log"
+	"strings"
+	"time"
+)
+
+// Balance returns the balance of the account as last read from the testnet. known is false if it was never read.
+func (acc *Account) Balance() (balance sdk.Coins, known bool) {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	return acc.balance, acc.balanceKnown
+}
+
+// TotalBalance adds up the known balances of all faucet accounts.
+func (ctx *Context) TotalBalance() sdk.Coins {
+	total := sdk.Coins{}
+	for _, acc := range ctx.Accounts {
+		if balance, known := acc.Balance(); known {
+			total = total.Plus(balance)
+		}
+	}
+	return total
+}
+
+// LowWaterMark returns the balance under which an alert is sent: LOWBALANCE, or one drop (AMOUNT) if it is not set.
+func (ctx *Context) LowWaterMark() (sdk.Coins, error) {
+	if ctx.Cfg.LowBalance != "" {
+		return sdk.ParseCoins(ctx.Cfg.LowBalance)
+	}
+	return sdk.ParseCoins(ctx.Cfg.Amount)
+}
+
+// LowDenoms returns the denominations of lowWater that balance has less of.
+func LowDenoms(balance sdk.Coins, lowWater sdk.Coins) (denoms []string) {
+	for _, mark := range lowWater {
+		if balance.AmountOf(mark.Denom).LT(mark.Amount) {
+			denoms = append(denoms, mark.Denom)
+		}
+	}
+	return
+}
+
+// MonitorBalance reads the balance of the faucet accounts every interval until stop is closed.
+// An alert is sent when a denomination drops below the low-water mark, and again when it is refilled.
+// The alert state is kept in the key-value store, so only one faucet process alerts about a transition.
+// With a treasury, the accounts below the refill threshold are refilled with refill after every check.
+func (ctx *Context) MonitorBalance(interval time.Duration, sinks []AlertSink, refill RefillFunc, stop <-chan struct{}) {
+	lowWater, err := ctx.LowWaterMark()
+	if err != nil {
+		log.Printf("balance monitoring disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx.checkBalance(lowWater, sinks, refill, interval)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkBalance refreshes the balances, alerts about the denominations that crossed the low-water mark
+// and refills the accounts that are low from the treasury.
+func (ctx *Context) checkBalance(lowWater sdk.Coins, sinks []AlertSink, refill RefillFunc, interval time.Duration) {
+	for _, acc := range ctx.Accounts {
+		err := ctx.RefreshAccountBalance(acc)
+		if err != nil {
+			log.Printf("could not read balance of %s: %v", acc.Address.String(), err)
+		}
+	}
+
+	total := ctx.TotalBalance()
+	isLow := make(map[string]bool)
+	for _, denom := range LowDenoms(total, lowWater) {
+		isLow[denom] = true
+	}
+
+	var dropped, refilled []string
+	for _, mark := range lowWater {
+		changed, err := ctx.balanceTransition(mark.Denom, isLow[mark.Denom])
+		if err != nil {
+			log.Printf("could not store the balance alert state of %s: %v", mark.Denom, err)
+			continue
+		}
+		if changed && isLow[mark.Denom] {
+			dropped = append(dropped, mark.Denom)
+		}
+		if changed && !isLow[mark.Denom] {
+			refilled = append(refilled, mark.Denom)
+		}
+	}
+
+	if len(dropped) > 0 {
+		ctx.alert(sinks, fmt.Sprintf("faucet balance low on %s", ctx.TestnetName()), fmt.Sprintf("The faucet of %s is low on %s: balance %s, low-water mark %s.",
+			ctx.TestnetName(), strings.Join(dropped, ", "), total.String(), lowWater.String()))
+	}
+	if len(refilled) > 0 {
+		ctx.alert(sinks, fmt.Sprintf("faucet balance refilled on %s", ctx.TestnetName()), fmt.Sprintf("The faucet of %s has enough %s again: balance %s.",
+			ctx.TestnetName(), strings.Join(refilled, ", "), total.String()))
+	}
+
+	if ctx.Treasury == nil || refill == nil {
+		return
+	}
+	for _, acc := range ctx.Accounts {
+		err := ctx.refillAccount(acc, refill, interval)
+		if err != nil {
+			log.Printf("could not refill %s: %v", acc.Address.String(), err)
+		}
+	}
+}
+
+// balanceTransition records that a denomination is low, or not. changed is true for the one check, in any faucet
+// process, that moves the denomination into the state. The first check of a denomination that is not low is no change.
+func (ctx *Context) balanceTransition(denom string, low bool) (changed bool, err error) {
+	lowKey := fmt.Sprintf("alert:low:%s", denom)
+	okKey := fmt.Sprintf("alert:ok:%s", denom)
+	if low {
+		changed, err = ctx.KV().SetIfNotExists(lowKey, "low", 0)
+		if err != nil || !changed {
+			return
+		}
+		err = ctx.KV().Delete(okKey)
+		return
+	}
+
+	_, wasLow, err := ctx.KV().Get(lowKey)
+	if err != nil {
+		return
+	}
+	changed, err = ctx.KV().SetIfNotExists(okKey, "ok", 0)
+	if err != nil || !changed {
+		return
+	}
+	err = ctx.KV().Delete(lowKey)
+	return wasLow, err
+}
+
+// alert logs an alert and delivers it to the sinks.
+func (ctx *Context) alert(sinks []AlertSink, subject string, message string) {
+	log.Printf("%s: %s", subject, message)
+	err := SendAlert(sinks, subject, message)
+	if err != nil {
+		log.Print(err)
+	}
+}
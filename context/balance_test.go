@@ -0,0 +1,58 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLowDenoms(t *testing.T) {
+	lowWater := sdk.Coins{sdk.NewInt64Coin("photino", 100), sdk.NewInt64Coin("steak", 100)}
+
+	assert.Nil(t, LowDenoms(sdk.Coins{sdk.NewInt64Coin("photino", 100), sdk.NewInt64Coin("steak", 500)}, lowWater))
+	assert.Equal(t, []string{"photino"}, LowDenoms(sdk.Coins{sdk.NewInt64Coin("photino", 99), sdk.NewInt64Coin("steak", 500)}, lowWater))
+	assert.Equal(t, []string{"photino", "steak"}, LowDenoms(sdk.Coins{}, lowWater))
+}
+
+func TestLowWaterMark(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Amount = "10steak"
+
+	lowWater, err := ctx.LowWaterMark()
+	assert.Nil(t, err)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 10)}, lowWater)
+
+	ctx.Cfg.LowBalance = "1000steak"
+	lowWater, err = ctx.LowWaterMark()
+	assert.Nil(t, err)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 1000)}, lowWater)
+}
+
+func TestBalanceTransitionOncePerProcesses(t *testing.T) {
+	// Two faucet processes share the key-value store
+	first := New()
+	second := New()
+	second.SetTestnet(first.Testnet())
+
+	changed, err := first.balanceTransition("steak", false)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	changed, err = first.balanceTransition("steak", true)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changed, err = second.balanceTransition("steak", true)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	changed, err = second.balanceTransition("steak", false)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changed, err = first.balanceTransition("steak", false)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	changed, err = second.balanceTransition("steak", true)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+}
@@ -0,0 +1,121 @@
+package context
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// BatchSendFunc sends one transaction to a list of recipients.
+type BatchSendFunc func(toBech32s []string) (height int64, hash string, status int, err error)
+
+// batchClaim is a claim waiting in the Batcher for the next transaction.
+type batchClaim struct {
+	address string
+	result  chan batchResult
+}
+
+// batchResult is the outcome of a batch transaction, shared by every claim in the batch.
+type batchResult struct {
+	height int64
+	hash   string
+	status int
+	err    error
+}
+
+// Batcher collects claims arriving within a time window (or up to a maximum number of recipients)
+// and sends them in a single transaction, so the faucet is not limited to one transaction per block.
+// Up to inFlight batches are sent at the same time, one per faucet account.
+type Batcher struct {
+	window   time.Duration
+	size     int
+	inFlight int
+	send     BatchSendFunc
+	claims   chan batchClaim
+}
+
+// NewBatcher creates a Batcher. Call Run to start processing claims.
+func NewBatcher(window time.Duration, size int, inFlight int, send BatchSendFunc) *Batcher {
+	if inFlight < 1 {
+		inFlight = 1
+	}
+	return &Batcher{
+		window:   window,
+		size:     size,
+		inFlight: inFlight,
+		send:     send,
+		claims:   make(chan batchClaim, size),
+	}
+}
+
+// Send adds a recipient to the next batch and waits until the batch transaction is sent.
+// Every claim in a batch receives the same hash and height.
+func (b *Batcher) Send(address string) (height int64, hash string, status int, err error) {
+	result := make(chan batchResult, 1)
+	b.claims <- batchClaim{address: address, result: result}
+	r := <-result
+	return r.height, r.hash, r.status, r.err
+}
+
+// Run collects and sends batches until stop is closed. Batches that are in flight when stop is closed
+// still report their results.
+func (b *Batcher) Run(stop <-chan struct{}) {
+	slots := make(chan struct{}, b.inFlight)
+	for {
+		var batch []batchClaim
+
+		// Wait for the first claim of the batch
+		select {
+		case <-stop:
+			return
+		case claim := <-b.claims:
+			batch = append(batch, claim)
+		}
+
+		// Collect more claims until the window closes or the batch is full
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(batch) < b.size {
+			select {
+			case claim := <-b.claims:
+				batch = append(batch, claim)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		// Wait for a free account, more claims queue up in the meantime
+		slots <- struct{}{}
+		go func(batch []batchClaim) {
+			defer func() { <-slots }()
+			b.sendBatch(batch)
+		}(batch)
+	}
+}
+
+// sendBatch sends a batch and reports the result to each waiting claim.
+func (b *Batcher) sendBatch(batch []batchClaim) {
+	addresses := make([]string, len(batch))
+	for i, claim := range batch {
+		addresses[i] = claim.address
+	}
+
+	var r batchResult
+	func() {
+		// Mutexes panic when they time out, which should fail the batch, not the Batcher.
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("batch of %d claims panicked: %v", len(batch), p)
+				r = batchResult{status: http.StatusInternalServerError, err: fmt.Errorf("%v", p)}
+			}
+		}()
+		log.Printf("sending batch of %d claims", len(batch))
+		r.height, r.hash, r.status, r.err = b.send(addresses)
+	}()
+
+	for _, claim := range batch {
+		claim.result <- r
+	}
+}
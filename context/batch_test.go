@@ -0,0 +1,81 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherSharesTransaction(t *testing.T) {
+	var sent [][]string
+	batcher := NewBatcher(200*time.Millisecond, 3, 1, func(toBech32s []string) (int64, string, int, error) {
+		sent = append(sent, toBech32s)
+		return int64(len(sent)), "HASH", http.StatusOK, nil
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go batcher.Run(stop)
+
+	var wg sync.WaitGroup
+	hashes := make([]string, 3)
+	for i, address := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			_, hash, status, err := batcher.Send(address)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, status)
+			hashes[i] = hash
+		}(i, address)
+	}
+	wg.Wait()
+
+	assert.Len(t, sent, 1)
+	sort.Strings(sent[0])
+	assert.Equal(t, []string{"a", "b", "c"}, sent[0])
+	assert.Equal(t, []string{"HASH", "HASH", "HASH"}, hashes)
+}
+
+func TestBatcherSendsBatchesInParallel(t *testing.T) {
+	// The batches are blocked until both are in flight, as if two faucet accounts sent them
+	inFlight := make(chan string, 2)
+	release := make(chan struct{})
+	batcher := NewBatcher(50*time.Millisecond, 1, 2, func(toBech32s []string) (int64, string, int, error) {
+		inFlight <- toBech32s[0]
+		<-release
+		return 1, toBech32s[0], http.StatusOK, nil
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go batcher.Run(stop)
+
+	var wg sync.WaitGroup
+	for _, address := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			_, hash, status, err := batcher.Send(address)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, address, hash)
+		}(address)
+	}
+
+	var sent []string
+	for range []string{"a", "b"} {
+		select {
+		case address := <-inFlight:
+			sent = append(sent, address)
+		case <-time.After(2 * time.Second):
+			t.Fatal("the second batch was not sent while the first one was in flight")
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	sort.Strings(sent)
+	assert.Equal(t, []string{"a", "b"}, sent)
+}
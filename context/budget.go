@@ -0,0 +1,241 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+// Error codes of claims that do not fit into a budget.
+const (
+	BudgetErrorExceeded  = "budget_exceeded"
+	BudgetErrorExhausted = "budget_exhausted"
+)
+
+// Budget caps the tokens the faucet gives away in a rolling window, or in total for the campaign budget.
+type Budget struct {
+	Name string
+	// Window is the length of the rolling window, zero for the campaign budget.
+	Window time.Duration
+	Limit  sdk.Coins
+}
+
+// BudgetUsage is the consumption of a budget in one denomination.
+type BudgetUsage struct {
+	Budget string  `json:"budget"`
+	Denom  string  `json:"denom"`
+	Used   sdk.Int `json:"used"`
+	Limit  sdk.Int `json:"limit"`
+}
+
+// Budgets returns the budgets configured with BUDGETHOUR, BUDGETDAY and BUDGETCAMPAIGN.
+func (ctx *Context) Budgets() (budgets []Budget, err error) {
+	for _, budget := range []struct {
+		name   string
+		window time.Duration
+		limit  string
+	}{
+		{"hour", time.Hour, ctx.Cfg.BudgetHour},
+		{"day", 24 * time.Hour, ctx.Cfg.BudgetDay},
+		{"campaign", 0, ctx.Cfg.BudgetCampaign},
+	} {
+		if budget.limit == "" {
+			continue
+		}
+		var limit sdk.Coins
+		limit, err = sdk.ParseCoins(budget.limit)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid %s budget: %v", budget.name, err))
+		}
+		budgets = append(budgets, Budget{Name: budget.name, Window: budget.window, Limit: limit})
+	}
+	return
+}
+
+// budgetKey is the counter of a budget in a denomination, in the window that contains t.
+func budgetKey(budget Budget, denom string, t time.Time) string {
+	if budget.Window == 0 {
+		return fmt.Sprintf("budget:%s:%s", budget.Name, denom)
+	}
+	return fmt.Sprintf("budget:%s:%s:%d", budget.Name, denom, t.UnixNano()/int64(budget.Window))
+}
+
+// budgetCount reads a budget counter. A missing counter is zero.
+func (ctx *Context) budgetCount(key string) (sdk.Int, error) {
+	value, found, err := ctx.KV().Get(key)
+	if err != nil {
+		return sdk.Int{}, err
+	}
+	if !found {
+		return sdk.NewInt(0), nil
+	}
+	count, ok := sdk.NewIntFromString(value)
+	if !ok {
+		return sdk.Int{}, errors.New(fmt.Sprintf("invalid budget counter %s: %s", key, value))
+	}
+	return count, nil
+}
+
+// budgetUsed estimates the consumption of a budget in the rolling window that ends at now: the count of
+// the current fixed window plus the part of the previous window that is still inside the rolling window.
+// It also returns the counts of both windows and how far now is into the current window.
+func (ctx *Context) budgetUsed(budget Budget, denom string, now time.Time) (used sdk.Int, previous sdk.Int, current sdk.Int, elapsed time.Duration, err error) {
+	current, err = ctx.budgetCount(budgetKey(budget, denom, now))
+	if err != nil || budget.Window == 0 {
+		return current, sdk.NewInt(0), current, 0, err
+	}
+	previous, err = ctx.budgetCount(budgetKey(budget, denom, now.Add(-budget.Window)))
+	if err != nil {
+		return
+	}
+	elapsed = time.Duration(now.UnixNano() % int64(budget.Window))
+	used = current.Add(previous.MulRaw(int64(budget.Window - elapsed)).DivRaw(int64(budget.Window)))
+	return
+}
+
+// intRatio returns a/b as a float, for amounts that do not fit into an int64.
+func intRatio(a sdk.Int, b sdk.Int) float64 {
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(a.BigInt()), new(big.Float).SetInt(b.BigInt())).Float64()
+	return ratio
+}
+
+// budgetRetryAfter returns how long until amount fits into the rolling window of a budget with limit,
+// given the counts of the previous and the current fixed window and how far into the current window it is.
+func budgetRetryAfter(limit sdk.Int, previous sdk.Int, current sdk.Int, amount sdk.Int, elapsed time.Duration, window time.Duration) time.Duration {
+	if amount.GT(limit) {
+		return window
+	}
+	// The previous window drops out of the rolling window linearly
+	free := limit.Sub(current).Sub(amount)
+	if free.Sign() >= 0 && previous.Sign() > 0 {
+		wait := time.Duration(float64(window)*(1-intRatio(free, previous))) - elapsed
+		if wait > 0 {
+			return wait
+		}
+		return time.Second
+	}
+	// Wait for the next window, where the current one drops out
+	wait := window - elapsed
+	if current.Sign() > 0 {
+		wait += time.Duration(float64(window) * (1 - intRatio(limit.Sub(amount), current)))
+	}
+	return wait
+}
+
+// ReserveBudget counts one drop (AMOUNT) against every budget. If a budget does not have room for it,
+// nothing is counted and an Error with the time until it has room is returned.
+// The campaign budget has no retry time: it does not refill.
+func (ctx *Context) ReserveBudget(now time.Time) (err error) {
+	budgets, err := ctx.Budgets()
+	if err != nil || len(budgets) == 0 {
+		return
+	}
+	amount, err := sdk.ParseCoins(ctx.Cfg.Amount)
+	if err != nil {
+		return
+	}
+
+	type reservation struct {
+		key    string
+		amount sdk.Int
+		ttl    time.Duration
+	}
+	var reserved []reservation
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, r := range reserved {
+			ctx.KV().IncrementByDecimal(r.key, r.amount.Neg().String(), r.ttl)
+		}
+	}()
+
+	for _, budget := range budgets {
+		for _, limit := range budget.Limit {
+			drop := amount.AmountOf(limit.Denom)
+			if drop.IsZero() {
+				continue
+			}
+			key := budgetKey(budget, limit.Denom, now)
+			ttl := 2 * budget.Window
+			_, err = ctx.KV().IncrementByDecimal(key, drop.String(), ttl)
+			if err != nil {
+				return
+			}
+			reserved = append(reserved, reservation{key: key, amount: drop, ttl: ttl})
+
+			var used, previous, current sdk.Int
+			var elapsed time.Duration
+			used, previous, current, elapsed, err = ctx.budgetUsed(budget, limit.Denom, now)
+			if err != nil {
+				return
+			}
+			if !used.GT(limit.Amount) {
+				continue
+			}
+
+			if budget.Window == 0 {
+				return NewError(BudgetErrorExhausted, fmt.Sprintf("the faucet gave away its %s budget of %s", budget.Name, limit.String()))
+			}
+			retryAfter := budgetRetryAfter(limit.Amount, previous, current.Sub(drop), drop, elapsed, budget.Window)
+			return &Error{
+				Code:       BudgetErrorExceeded,
+				Message:    fmt.Sprintf("the faucet gave away its %s budget of %s, try again in %s", budget.Name, limit.String(), retryAfter.Round(time.Second)),
+				RetryAfter: retryAfter,
+			}
+		}
+	}
+	return
+}
+
+// ReleaseBudget gives back a drop reserved by ReserveBudget at reservedAt, because the claim did not go through.
+func (ctx *Context) ReleaseBudget(reservedAt time.Time) error {
+	budgets, err := ctx.Budgets()
+	if err != nil || len(budgets) == 0 {
+		return err
+	}
+	amount, err := sdk.ParseCoins(ctx.Cfg.Amount)
+	if err != nil {
+		return err
+	}
+	for _, budget := range budgets {
+		for _, limit := range budget.Limit {
+			drop := amount.AmountOf(limit.Denom)
+			if drop.IsZero() {
+				continue
+			}
+			_, err = ctx.KV().IncrementByDecimal(budgetKey(budget, limit.Denom, reservedAt), drop.Neg().String(), 2*budget.Window)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BudgetUsage reports the consumption of every budget.
+func (ctx *Context) BudgetUsage() (usage []BudgetUsage, err error) {
+	budgets, err := ctx.Budgets()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, budget := range budgets {
+		for _, limit := range budget.Limit {
+			var used sdk.Int
+			used, _, _, _, err = ctx.budgetUsed(budget, limit.Denom, now)
+			if err != nil {
+				return
+			}
+			usage = append(usage, BudgetUsage{
+				Budget: budget.Name,
+				Denom:  limit.Denom,
+				Used:   used,
+				Limit:  limit.Amount,
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBudgetRetryAfter(t *testing.T) {
+	// Nothing left from the previous window: wait for the next window, and until enough of this one dropped out
+	assert.Equal(t, 45*time.Minute, budgetRetryAfter(sdk.NewInt(100), sdk.NewInt(0), sdk.NewInt(80), sdk.NewInt(60), 45*time.Minute, time.Hour))
+
+	// Room in this window once enough of the previous one dropped out
+	assert.Equal(t, 15*time.Minute, budgetRetryAfter(sdk.NewInt(100), sdk.NewInt(80), sdk.NewInt(40), sdk.NewInt(20), 15*time.Minute, time.Hour))
+
+	// A drop bigger than the budget never fits
+	assert.Equal(t, time.Hour, budgetRetryAfter(sdk.NewInt(10), sdk.NewInt(0), sdk.NewInt(0), sdk.NewInt(20), 0, time.Hour))
+}
+
+func TestReserveBudget(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Amount = "10steak"
+	ctx.Cfg.BudgetHour = "25steak"
+
+	now := time.Now()
+	assert.Nil(t, ctx.ReserveBudget(now))
+	assert.Nil(t, ctx.ReserveBudget(now))
+	err := ctx.ReserveBudget(now)
+	assert.NotNil(t, err)
+	assert.Equal(t, BudgetErrorExceeded, err.(*Error).Code)
+	assert.True(t, err.(*Error).RetryAfter > 0)
+
+	// A refused claim is not counted, and a released one gives its drop back
+	usage, err := ctx.BudgetUsage()
+	assert.Nil(t, err)
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, "hour", usage[0].Budget)
+		assert.Equal(t, "steak", usage[0].Denom)
+		assert.Equal(t, "20", usage[0].Used.String())
+		assert.Equal(t, "25", usage[0].Limit.String())
+	}
+	assert.Nil(t, ctx.ReleaseBudget(now))
+	assert.Nil(t, ctx.ReserveBudget(now))
+}
+
+func TestReserveBudgetCampaign(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Amount = "10steak,5photino"
+	ctx.Cfg.BudgetHour = "100steak"
+	ctx.Cfg.BudgetCampaign = "10photino"
+
+	now := time.Now()
+	assert.Nil(t, ctx.ReserveBudget(now))
+	assert.Nil(t, ctx.ReserveBudget(now))
+	err := ctx.ReserveBudget(now)
+	assert.NotNil(t, err)
+	assert.Equal(t, BudgetErrorExhausted, err.(*Error).Code)
+	assert.Equal(t, time.Duration(0), err.(*Error).RetryAfter)
+
+	// The hourly budget was rolled back too
+	usage, err := ctx.BudgetUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, "20", usage[0].Used.String())
+}
+
+func TestReserveBudgetBeyondInt64(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Amount = "10000000000000000000steak"
+	ctx.Cfg.BudgetCampaign = "25000000000000000000steak"
+
+	now := time.Now()
+	assert.Nil(t, ctx.ReserveBudget(now))
+	assert.Nil(t, ctx.ReserveBudget(now))
+	err := ctx.ReserveBudget(now)
+	assert.NotNil(t, err)
+
+	usage, err := ctx.BudgetUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, "20000000000000000000", usage[0].Used.String())
+	assert.Equal(t, "25000000000000000000", usage[0].Limit.String())
+}
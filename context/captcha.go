@@ -0,0 +1,169 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Verification endpoints of the captcha providers.
+const (
+	RecaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	HCaptchaVerifyURL  = "https://hcaptcha.com/siteverify"
+	TurnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// Verifier checks the captcha response sent with a claim.
+type Verifier interface {
+	// Verify returns true if the captcha was solved by the client at remoteIP.
+	Verify(remoteIP string, response string) (bool, error)
+}
+
+// NewVerifier creates the Verifier of the captcha provider set in CAPTCHAPROVIDER.
+// CAPTCHAURL overrides the verification endpoint of the provider.
+func (ctx *Context) NewVerifier() (Verifier, error) {
+	secret := ctx.Cfg.CaptchaSecret
+	if secret == "" {
+		secret = ctx.Cfg.RecaptchaSecret
+	}
+
+	switch ctx.Cfg.CaptchaProvider {
+	case "", defaults.CaptchaRecaptcha:
+		return NewRecaptchaV2Verifier(secret, ctx.Cfg.CaptchaURL), nil
+	case defaults.CaptchaRecaptchaV3:
+		return NewRecaptchaV3Verifier(secret, ctx.Cfg.CaptchaURL, ctx.Cfg.CaptchaMinScore, ctx.Cfg.CaptchaAction), nil
+	case defaults.CaptchaHCaptcha:
+		return NewHCaptchaVerifier(secret, ctx.Cfg.CaptchaURL), nil
+	case defaults.CaptchaTurnstile:
+		return NewTurnstileVerifier(secret, ctx.Cfg.CaptchaURL), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown captcha provider %s", ctx.Cfg.CaptchaProvider))
+	}
+}
+
+// siteVerifyResponse is the answer of a verification endpoint. reCAPTCHA, hCaptcha and Turnstile share the format,
+// score and action are only set by reCAPTCHA v3.
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      float64  `json:"score"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// siteVerifier is a Verifier that posts the response to a siteverify endpoint.
+type siteVerifier struct {
+	name      string
+	secret    string
+	verifyURL string
+	client    *http.Client
+}
+
+func newSiteVerifier(name string, secret string, verifyURL string, defaultURL string) *siteVerifier {
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	return &siteVerifier{
+		name:      name,
+		secret:    secret,
+		verifyURL: verifyURL,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// NewRecaptchaV2Verifier creates a Verifier for reCAPTCHA v2. An empty verifyURL uses the Google endpoint.
+func NewRecaptchaV2Verifier(secret string, verifyURL string) Verifier {
+	return newSiteVerifier("recaptcha", secret, verifyURL, RecaptchaVerifyURL)
+}
+
+// NewHCaptchaVerifier creates a Verifier for hCaptcha. An empty verifyURL uses the hCaptcha endpoint.
+func NewHCaptchaVerifier(secret string, verifyURL string) Verifier {
+	return newSiteVerifier("hcaptcha", secret, verifyURL, HCaptchaVerifyURL)
+}
+
+// NewTurnstileVerifier creates a Verifier for Cloudflare Turnstile. An empty verifyURL uses the Cloudflare endpoint.
+func NewTurnstileVerifier(secret string, verifyURL string) Verifier {
+	return newSiteVerifier("turnstile", secret, verifyURL, TurnstileVerifyURL)
+}
+
+// Verify posts the response to the verification endpoint.
+func (v *siteVerifier) Verify(remoteIP string, response string) (bool, error) {
+	result, err := v.siteVerify(remoteIP, response)
+	if err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+func (v *siteVerifier) siteVerify(remoteIP string, response string) (result siteVerifyResponse, err error) {
+	if response == "" {
+		return
+	}
+
+	resp, err := v.client.PostForm(v.verifyURL, url.Values{
+		"secret":   {v.secret},
+		"response": {response},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = errors.New(fmt.Sprintf("http error code %d calling %s verification URL", resp.StatusCode, v.name))
+		return
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return
+	}
+	if !result.Success && len(result.ErrorCodes) > 0 {
+		log.Printf("%s verification failed: %s", v.name, strings.Join(result.ErrorCodes, ","))
+	}
+	return
+}
+
+// recaptchaV3Verifier is a Verifier for reCAPTCHA v3. Solved captchas also need a high enough score
+// and the action set by the front-end.
+type recaptchaV3Verifier struct {
+	*siteVerifier
+	minScore float64
+	action   string
+}
+
+// NewRecaptchaV3Verifier creates a Verifier for reCAPTCHA v3. Responses scored below minScore are refused.
+// If action is not empty, the action of the response has to match it.
+func NewRecaptchaV3Verifier(secret string, verifyURL string, minScore float64, action string) Verifier {
+	return &recaptchaV3Verifier{
+		siteVerifier: newSiteVerifier("recaptcha", secret, verifyURL, RecaptchaVerifyURL),
+		minScore:     minScore,
+		action:       action,
+	}
+}
+
+// Verify posts the response to the verification endpoint and checks the score and the action.
+func (v *recaptchaV3Verifier) Verify(remoteIP string, response string) (bool, error) {
+	result, err := v.siteVerify(remoteIP, response)
+	if err != nil {
+		return false, err
+	}
+	if !result.Success {
+		return false, nil
+	}
+	if result.Score < v.minScore {
+		log.Printf("recaptcha score %.2f is below %.2f", result.Score, v.minScore)
+		return false, nil
+	}
+	if v.action != "" && result.Action != v.action {
+		log.Printf("recaptcha action %s does not match %s", result.Action, v.action)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newCaptchaStub starts a verification endpoint that answers body to the response "good" and a failure otherwise.
+func newCaptchaStub(t *testing.T, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.FormValue("secret"))
+		assert.Equal(t, "127.0.0.1", r.FormValue("remoteip"))
+		if r.FormValue("response") != "good" {
+			w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestSiteVerifiers(t *testing.T) {
+	stub := newCaptchaStub(t, `{"success":true}`)
+	defer stub.Close()
+
+	for _, verifier := range []Verifier{
+		NewRecaptchaV2Verifier("secret", stub.URL),
+		NewHCaptchaVerifier("secret", stub.URL),
+		NewTurnstileVerifier("secret", stub.URL),
+	} {
+		passed, err := verifier.Verify("127.0.0.1", "good")
+		assert.Nil(t, err)
+		assert.True(t, passed)
+
+		passed, err = verifier.Verify("127.0.0.1", "bad")
+		assert.Nil(t, err)
+		assert.False(t, passed)
+
+		passed, err = verifier.Verify("127.0.0.1", "")
+		assert.Nil(t, err)
+		assert.False(t, passed)
+	}
+}
+
+func TestRecaptchaV3Verifier(t *testing.T) {
+	stub := newCaptchaStub(t, `{"success":true,"score":0.7,"action":"claim"}`)
+	defer stub.Close()
+
+	passed, err := NewRecaptchaV3Verifier("secret", stub.URL, 0.5, "claim").Verify("127.0.0.1", "good")
+	assert.Nil(t, err)
+	assert.True(t, passed)
+
+	passed, err = NewRecaptchaV3Verifier("secret", stub.URL, 0.9, "claim").Verify("127.0.0.1", "good")
+	assert.Nil(t, err)
+	assert.False(t, passed)
+
+	passed, err = NewRecaptchaV3Verifier("secret", stub.URL, 0.5, "login").Verify("127.0.0.1", "good")
+	assert.Nil(t, err)
+	assert.False(t, passed)
+}
+
+func TestNewVerifier(t *testing.T) {
+	ctx := New()
+
+	ctx.Cfg.CaptchaProvider = "hcaptcha"
+	_, err := ctx.NewVerifier()
+	assert.Nil(t, err)
+
+	ctx.Cfg.CaptchaProvider = "unknown"
+	_, err = ctx.NewVerifier()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,103 @@
+package context
+
+import (
+	"fmt"
+	"github.com/cosmos/faucet-backend/config"
+	"sync"
+	"time"
+)
+
+// chainRetryInterval is how long a chain that failed to initialize is left alone before the next attempt.
+const chainRetryInterval = 30 * time.Second
+
+// ChainInitializer sets up the Context of a chain in multi-chain mode.
+type ChainInitializer func(chain *Chain) (*Context, error)
+
+// Chain is a testnet served by a multi-chain deployment. Each chain has its own Context:
+// its own wallets, lock namespace, rate limiter store prefix and health state.
+type Chain struct {
+	Name string
+	Cfg  *config.Config
+
+	lock        sync.Mutex
+	ctx         *Context
+	err         error
+	lastAttempt time.Time
+}
+
+// NewChain creates a chain that is not initialized yet.
+func NewChain(cfg *config.Config) *Chain {
+	return &Chain{
+		Name: cfg.Name,
+		Cfg:  cfg,
+	}
+}
+
+// Context returns the initialized Context of the chain. If the chain is not initialized yet,
+// or the previous attempt failed more than chainRetryInterval ago, it tries to initialize it with init.
+// A broken chain returns an error without affecting the others.
+func (c *Chain) Context(init ChainInitializer) (*Context, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.ctx != nil {
+		return c.ctx, nil
+	}
+	if c.err != nil && time.Since(c.lastAttempt) < chainRetryInterval {
+		return nil, c.err
+	}
+
+	c.lastAttempt = time.Now()
+	c.ctx, c.err = init(c)
+	if c.err != nil {
+		// The next attempt starts its own background work
+		if c.ctx != nil {
+			c.ctx.Stop()
+		}
+		c.ctx = nil
+		c.err = fmt.Errorf("chain %s is unavailable: %v", c.Name, c.err)
+	}
+	return c.ctx, c.err
+}
+
+// Status returns the testnet name of an initialized chain and the reason of the failure, if it is broken.
+func (c *Chain) Status() (testnetName string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ctx != nil {
+		return c.ctx.TestnetName(), nil
+	}
+	if c.err == nil {
+		return "", fmt.Errorf("chain %s is not initialized", c.Name)
+	}
+	return "", c.err
+}
+
+// Chain returns the chain with the given name. found is false if no such chain is configured.
+func (ctx *Context) Chain(name string) (chain *Chain, found bool) {
+	for _, chain = range ctx.Chains {
+		if chain.Name == name {
+			return chain, true
+		}
+	}
+	return nil, false
+}
+
+// LockPrefix is the namespace of the mutexes and the key-value store of the context.
+// In multi-chain mode the chain name is part of it, so chains never share state.
+func (ctx *Context) LockPrefix() string {
+	return ctx.lockPrefix(ctx.TestnetName())
+}
+
+// lockPrefix is the namespace of the mutexes and the key-value store of the context on the testnet testnetName.
+func (ctx *Context) lockPrefix(testnetName string) string {
+	return fmt.Sprintf("%s-%s", ctx.ChainPrefix(), testnetName)
+}
+
+// ChainPrefix is the namespace of the ChainKV store. It does not change with the testnet.
+func (ctx *Context) ChainPrefix() string {
+	if ctx.ChainName != "" {
+		return fmt.Sprintf("%s-%s", ctx.Cfg.ApiEnvironment, ctx.ChainName)
+	}
+	return ctx.Cfg.ApiEnvironment
+}
@@ -0,0 +1,37 @@
+package context
+
+import (
+	"errors"
+	"github.com/cosmos/faucet-backend/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChainStopsFailedContext(t *testing.T) {
+	chain := NewChain(&config.Config{Name: "gaia-13003"})
+
+	// The background work of a failed attempt ends, so retries do not pile it up
+	var failed *Context
+	_, err := chain.Context(func(*Chain) (*Context, error) {
+		failed = New()
+		return failed, errors.New("node down")
+	})
+	assert.NotNil(t, err)
+	select {
+	case <-failed.Done():
+	default:
+		t.Error("the context of the failed attempt was not stopped")
+	}
+
+	chain.lastAttempt = time.Now().Add(-chainRetryInterval)
+	ctx, err := chain.Context(func(*Chain) (*Context, error) {
+		return New(), nil
+	})
+	assert.Nil(t, err)
+	select {
+	case <-ctx.Done():
+		t.Error("the context of the chain was stopped")
+	default:
+	}
+}
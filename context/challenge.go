@@ -0,0 +1,142 @@
+package context
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// Challenge is a proof-of-work puzzle bound to an address and a chain. The client has to find a nonce so that
+// the SHA-256 hash of the challenge token followed by the nonce starts with Difficulty zero bits.
+type Challenge struct {
+	Address    string `json:"address"`
+	Chain      string `json:"chain"`
+	Difficulty int64  `json:"difficulty"`
+	Expires    int64  `json:"expires"`
+	Salt       string `json:"salt"`
+}
+
+// IssueChallenge creates a signed challenge for an address. Difficulty is raised while many challenges are requested.
+func (ctx *Context) IssueChallenge(address string) (token string, challenge Challenge, err error) {
+	difficulty, err := ctx.challengeDifficulty()
+	if err != nil {
+		return
+	}
+
+	salt, err := NewRandomID()
+	if err != nil {
+		return
+	}
+
+	challenge = Challenge{
+		Address:    address,
+		Chain:      ctx.challengeChain(),
+		Difficulty: difficulty,
+		Expires:    time.Now().Add(time.Duration(ctx.Cfg.PowTTL) * time.Second).Unix(),
+		Salt:       salt,
+	}
+	payload, err := json.Marshal(challenge)
+	if err != nil {
+		return
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	token = fmt.Sprintf("%s.%s", encodedPayload, ctx.signChallenge(encodedPayload))
+	return
+}
+
+// VerifyChallenge checks that the challenge token was issued by the faucet for the address on this chain, did not expire,
+// is solved by nonce and was not used before. The challenge is recorded as used.
+func (ctx *Context) VerifyChallenge(token string, nonce string, address string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(ctx.signChallenge(parts[0]))) {
+		return NewError("challenge_invalid", "the challenge was not issued by this faucet")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	var challenge Challenge
+	err = json.Unmarshal(payload, &challenge)
+	if err != nil {
+		return err
+	}
+
+	if challenge.Address != address {
+		return NewError("challenge_invalid", "the challenge was issued for another address")
+	}
+	if challenge.Chain != ctx.challengeChain() {
+		return NewError("challenge_invalid", "the challenge was issued for another chain")
+	}
+	expires := time.Unix(challenge.Expires, 0)
+	if time.Now().After(expires) {
+		return NewError("challenge_expired", "the challenge expired, request a new one")
+	}
+	if !ChallengeSolved(token, nonce, challenge.Difficulty) {
+		return NewError("challenge_unsolved", "the nonce does not solve the challenge")
+	}
+
+	ok, err := ctx.KV().SetIfNotExists(fmt.Sprintf("challenge:%s", parts[1]), nonce, time.Until(expires)+time.Minute)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NewError("challenge_used", "the challenge was already used, request a new one")
+	}
+	return nil
+}
+
+// ChallengeSolved tells if the SHA-256 hash of token and nonce starts with difficulty zero bits.
+func ChallengeSolved(token string, nonce string, difficulty int64) bool {
+	if nonce == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token + nonce))
+	var zeros int64
+	for _, b := range hash {
+		zeros += int64(bits.LeadingZeros8(b))
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// challengeChain is the chain a challenge is issued for: the chain name in multi-chain mode, the testnet otherwise.
+// Chains can share POWSECRET, so a challenge solved for one chain does not claim on another.
+func (ctx *Context) challengeChain() string {
+	if ctx.ChainName != "" {
+		return ctx.ChainName
+	}
+	return ctx.TestnetName()
+}
+
+// signChallenge returns the HMAC signature of an encoded challenge payload.
+func (ctx *Context) signChallenge(encodedPayload string) string {
+	mac := hmac.New(sha256.New, []byte(ctx.Cfg.PowSecret))
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// challengeDifficulty counts the challenges issued in the current minute. Each time the count doubles
+// over POWLOADTHRESHOLD the difficulty is raised by one bit, up to POWMAXDIFFICULTY.
+func (ctx *Context) challengeDifficulty() (int64, error) {
+	issued, err := ctx.KV().Increment(fmt.Sprintf("challenges:%d", time.Now().Unix()/60), 2*time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	difficulty := ctx.Cfg.PowDifficulty
+	if ctx.Cfg.PowLoadThreshold <= 0 {
+		return difficulty, nil
+	}
+	for threshold := ctx.Cfg.PowLoadThreshold; issued > threshold && difficulty < ctx.Cfg.PowMaxDifficulty; threshold *= 2 {
+		difficulty++
+	}
+	return difficulty, nil
+}
@@ -0,0 +1,91 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+// solveChallenge finds a nonce for a challenge token.
+func solveChallenge(token string, difficulty int64) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if ChallengeSolved(token, nonce, difficulty) {
+			return nonce
+		}
+	}
+}
+
+func newChallengeContext() *Context {
+	ctx := New()
+	ctx.Cfg.PowSecret = "secret"
+	ctx.Cfg.PowDifficulty = 8
+	ctx.Cfg.PowMaxDifficulty = 10
+	ctx.Cfg.PowLoadThreshold = 2
+	ctx.Cfg.PowTTL = 60
+	return ctx
+}
+
+func TestChallenge(t *testing.T) {
+	ctx := newChallengeContext()
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8catxrqxv"
+
+	token, challenge, err := ctx.IssueChallenge(address)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), challenge.Difficulty)
+	nonce := solveChallenge(token, challenge.Difficulty)
+
+	err = ctx.VerifyChallenge(token, nonce, "cosmos1other")
+	assert.Equal(t, "challenge_invalid", err.(*Error).Code)
+
+	err = ctx.VerifyChallenge(token+"x", nonce, address)
+	assert.Equal(t, "challenge_invalid", err.(*Error).Code)
+
+	err = ctx.VerifyChallenge(token, nonce, address)
+	assert.Nil(t, err)
+
+	err = ctx.VerifyChallenge(token, nonce, address)
+	assert.Equal(t, "challenge_used", err.(*Error).Code)
+}
+
+func TestChallengeOtherChain(t *testing.T) {
+	ctx := newChallengeContext()
+	ctx.ChainName = "gaia"
+	other := newChallengeContext()
+	other.ChainName = "kava"
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8catxrqxv"
+
+	// Chains with the same POWSECRET do not accept each other's challenges
+	token, challenge, err := ctx.IssueChallenge(address)
+	assert.Nil(t, err)
+	assert.Equal(t, "gaia", challenge.Chain)
+	nonce := solveChallenge(token, challenge.Difficulty)
+	err = other.VerifyChallenge(token, nonce, address)
+	assert.Equal(t, "challenge_invalid", err.(*Error).Code)
+
+	err = ctx.VerifyChallenge(token, nonce, address)
+	assert.Nil(t, err)
+}
+
+func TestChallengeExpired(t *testing.T) {
+	ctx := newChallengeContext()
+	ctx.Cfg.PowTTL = -1
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8catxrqxv"
+
+	token, challenge, err := ctx.IssueChallenge(address)
+	assert.Nil(t, err)
+	err = ctx.VerifyChallenge(token, solveChallenge(token, challenge.Difficulty), address)
+	assert.Equal(t, "challenge_expired", err.(*Error).Code)
+}
+
+func TestChallengeDifficultyUnderLoad(t *testing.T) {
+	ctx := newChallengeContext()
+
+	var difficulties []int64
+	for i := 0; i < 10; i++ {
+		_, challenge, err := ctx.IssueChallenge("cosmos1kje2wjc66mc3u283dy80czej8m9su8catxrqxv")
+		assert.Nil(t, err)
+		difficulties = append(difficulties, challenge.Difficulty)
+	}
+	assert.Equal(t, []int64{8, 8, 9, 9, 10, 10, 10, 10, 10, 10}, difficulties)
+}
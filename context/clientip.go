@@ -0,0 +1,96 @@
+package context
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses the TRUSTEDPROXIES list. An IP address without a prefix length is a single host.
+func ParseTrustedProxies(proxies []string) (networks []*net.IPNet, err error) {
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("invalid trusted proxy %s", proxy))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		var network *net.IPNet
+		_, network, err = net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid trusted proxy %s: %v", proxy, err))
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// isTrustedProxy tells if ip belongs to one of the trusted proxies.
+func (ctx *Context) isTrustedProxy(ip net.IP) bool {
+	for _, network := range ctx.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that sent a request. It identifies the client for logging,
+// rate limiting and captcha verification.
+//
+// On AWS Lambda it is the source IP that API Gateway saw. Otherwise it is the peer address of the connection,
+// unless that is a trusted proxy: then X-Forwarded-For is read from right to left, skipping the trusted
+// proxies, up to the first address that is not one. X-Real-IP is used if a trusted proxy does not send
+// X-Forwarded-For.
+func (ctx *Context) ClientIP(r *http.Request) string {
+	if ctx.SourceIPHeader != "" {
+		if sourceIP := r.Header.Get(ctx.SourceIPHeader); sourceIP != "" {
+			return sourceIP
+		}
+	}
+
+	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+	client := net.ParseIP(remoteAddr)
+	if client == nil || !ctx.isTrustedProxy(client) {
+		return remoteAddr
+	}
+
+	var hops []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+		return client.String()
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// Whatever is left of a malformed entry was not written by a trusted proxy
+			break
+		}
+		client = hop
+		if !ctx.isTrustedProxy(hop) {
+			break
+		}
+	}
+	return client.String()
+}
@@ -0,0 +1,51 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	ctx := New()
+	var err error
+	ctx.TrustedProxies, err = ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	assert.Nil(t, err)
+
+	request := func(remoteAddr string, headers map[string][]string) *http.Request {
+		r, err := http.NewRequest("GET", "/", nil)
+		assert.Nil(t, err)
+		r.RemoteAddr = remoteAddr
+		r.Header = headers
+		return r
+	}
+
+	// Clients cannot pick their own IP address
+	assert.Equal(t, "1.2.3.4", ctx.ClientIP(request("1.2.3.4:5678", map[string][]string{
+		"X-Forwarded-For": {"5.6.7.8"},
+		"X-Real-Ip":       {"5.6.7.8"},
+	})))
+
+	// Trusted proxies are skipped from the right, up to the first address that is not one
+	assert.Equal(t, "5.6.7.8", ctx.ClientIP(request("10.0.0.1:5678", map[string][]string{
+		"X-Forwarded-For": {"9.9.9.9, 5.6.7.8", "192.168.1.1"},
+	})))
+	assert.Equal(t, "5.6.7.8", ctx.ClientIP(request("[fd00::1]:5678", map[string][]string{
+		"X-Forwarded-For": {"5.6.7.8, 10.1.2.3"},
+	})))
+	assert.Equal(t, "10.1.2.3", ctx.ClientIP(request("10.0.0.1:5678", map[string][]string{
+		"X-Forwarded-For": {"garbage, 10.1.2.3"},
+	})))
+	assert.Equal(t, "5.6.7.8", ctx.ClientIP(request("10.0.0.1:5678", map[string][]string{
+		"X-Real-Ip": {"5.6.7.8"},
+	})))
+
+	// On AWS Lambda the source IP is passed in a header
+	ctx.SourceIPHeader = "X-F11-Source-Ip"
+	assert.Equal(t, "5.6.7.8", ctx.ClientIP(request("", map[string][]string{
+		"X-F11-Source-Ip": {"5.6.7.8"},
+	})))
+
+	_, err = ParseTrustedProxies([]string{"not-a-proxy"})
+	assert.NotNil(t, err)
+}
@@ -2,46 +2,69 @@
 package context
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	sdkCtx "github.com/cosmos/cosmos-sdk/client/context"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/cosmos/cosmos-sdk/wire"
 	"github.com/cosmos/cosmos-sdk/x/auth"
 	authctx "github.com/cosmos/cosmos-sdk/x/auth/client/context"
 	"github.com/cosmos/faucet-backend/config"
 	"github.com/cosmos/faucet-backend/defaults"
-	"github.com/greg-szabo/dsync/ddb/sync"
+	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/libs/bech32"
 	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 	"github.com/tendermint/tendermint/rpc/lib/types"
 	"github.com/throttled/throttled"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
 // Context holds current execution details.
 type Context struct {
 
-	// Throttled Rate Limiter
-	HttpRateLimiter throttled.HTTPRateLimiter
+	// Rate limiter with the rate-limit policies
+	RateLimiter *RateLimiter
 
 	// Throttled Rate Limiter Store
 	Store throttled.GCRAStore
 
-	// SequenceMutex stores the current last sequence number of the account on the testnet
-	SequenceMutex      sync.Mutex
-	// AccountNumberMutex stores the account number on the testnet for the respective wallet
-	AccountNumberMutex sync.Mutex
-	// BrokenFlagMutex stores if the last execution of the application was successful (tokens were sent)
-	BrokenFlagMutex    sync.Mutex
+	// RedisDB client shared by the rate limiter store and the redis lock backend (nil with --no-rdb)
+	RedisClient *redis.Client
+
+	// Captcha verifies the captcha responses of the claims
+	Captcha Verifier
+
+	// Batcher combines claims into multi-recipient transactions (nil if batching is disabled)
+	Batcher *Batcher
+
+	// Accounts are the faucet wallets that pay for claims
+	Accounts []*Account
 
 	// Deprecated: We only need to read AccountNumber once at startup, we store it for subsequent use
 	AccountNumber int64
 
-	// TestnetName returned from the full node
-	TestnetName string
+	// testnet is the state of the current testnet, see Testnet
+	testnetLock sync.RWMutex
+	testnet     Testnet
+
+	// ChainKV is the key-value store of the chain, shared by all its testnets, so a testnet reset keeps it
+	ChainKV KVStore
+
+	// ChainName is the name of the chain in multi-chain mode (empty in single chain mode)
+	ChainName string
+
+	// Chains served in multi-chain mode, each with its own Context
+	Chains []*Chain
 
 	// Application configuration
 	Cfg *config.Config
@@ -55,14 +78,50 @@ type Context struct {
 	// Disable ReCaptcha check for testing
 	DisableRecaptcha bool
 
+	// Proxies allowed to tell the client IP with X-Forwarded-For, see ClientIP
+	TrustedProxies []*net.IPNet
+
+	// Header with the source IP set by LambdaHandler (empty outside AWS Lambda), see ClientIP
+	SourceIPHeader string
+
 	// Amino MarshalBinary for transaction broadcast on blockchain network
 	Cdc *wire.Codec
 
 	// The new CLIContext for connecting to a network
 	CLIContext *sdkCtx.CLIContext
 
-	// The new TxContext for sending a transaction on the network
-	TxContest *authctx.TxContext
+	// NODE and LCDNODE endpoints, ranked by health
+	Nodes    *EndpointPool
+	LCDNodes *EndpointPool
+
+	// Refills the faucet accounts, nil without a treasury
+	Treasury *Account
+
+	// Reads account state from the LCD node or the node
+	AccountReader AccountReader
+
+	// CLIContexts connected to the NODE endpoints, see NodeContext
+	nodeContexts sync.Map
+
+	// Testnet resets noticed by WatchTestnet
+	resets resetMetrics
+
+	// stop is closed by Stop to end the background work of the context
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Testnet is the state of a context that belongs to the testnet it sends on. A testnet reset replaces it as a whole,
+// so readers always get the name and the key-value store of the same testnet.
+type Testnet struct {
+	// Name returned from the full node
+	Name string
+
+	// Key-value store for shared faucet state (claim ledger), in the same backend as the rate limiter store
+	KV KVStore
+
+	// The TxContext for sending a transaction on the network
+	TxContext *authctx.TxContext
 }
 
 // InitialContext holds the input parameter details at the start of execution.
@@ -73,6 +132,15 @@ type InitialContext struct {
 	// --send Send to a wallet locally
 	Send string
 
+	// --worker Process queued claim jobs
+	Worker bool
+
+	// --chain Chain to use with --send or --ratelimits in multi-chain mode
+	Chain string
+
+	// --ratelimits Store the rate-limit policies of this file in the key-value store
+	RateLimits string
+
 	// --ip IP address of local webserver
 	WebserverIp string
 
@@ -82,7 +150,7 @@ type InitialContext struct {
 	// --config Config file for local execution
 	ConfigFile string
 
-	// --webserver or --send was set
+	// --webserver, --send or --worker was set
 	LocalExecution bool
 
 	// --no-limit Disable rate limiter
@@ -95,9 +163,58 @@ type InitialContext struct {
 	DisableRecaptcha bool
 }
 
-// New creates a fresh Context.
+// New creates a fresh Context. Configuration is empty and the key-value store is in-process
+// until Initialization sets up the configured backends.
 func New() *Context {
-	return &Context{}
+	return &Context{
+		Cfg:     &config.Config{},
+		testnet: Testnet{KV: NewMemKVStore("")},
+		ChainKV: NewMemKVStore(""),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Done returns a channel that is closed when the background work of the context has to end.
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.stop
+}
+
+// Stop ends the background work of the context: health checks, testnet watch, balance monitoring and batching.
+func (ctx *Context) Stop() {
+	ctx.stopOnce.Do(func() {
+		close(ctx.stop)
+	})
+}
+
+// Testnet returns the state of the current testnet.
+func (ctx *Context) Testnet() Testnet {
+	ctx.testnetLock.RLock()
+	defer ctx.testnetLock.RUnlock()
+	return ctx.testnet
+}
+
+// SetTestnet replaces the state of the current testnet.
+func (ctx *Context) SetTestnet(testnet Testnet) {
+	ctx.testnetLock.Lock()
+	ctx.testnet = testnet
+	ctx.testnetLock.Unlock()
+}
+
+// TestnetName returns the name of the current testnet.
+func (ctx *Context) TestnetName() string {
+	return ctx.Testnet().Name
+}
+
+// SetTestnetName changes the name of the current testnet.
+func (ctx *Context) SetTestnetName(name string) {
+	ctx.testnetLock.Lock()
+	ctx.testnet.Name = name
+	ctx.testnetLock.Unlock()
+}
+
+// KV returns the key-value store of the current testnet.
+func (ctx *Context) KV() KVStore {
+	return ctx.Testnet().KV
 }
 
 // NewInitialContext creates a fresh InitialContext.
@@ -105,9 +222,41 @@ func NewInitialContext() *InitialContext {
 	return &InitialContext{}
 }
 
+// NewRandomID returns a random hex string that can be used as a unique identifier.
+func NewRandomID() (string, error) {
+	bz := make([]byte, 16)
+	if _, err := rand.Read(bz); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bz), nil
+}
+
 // ErrorMessage defines the message structure returned when an error happens.
 type ErrorMessage struct {
-	Message string `json:"message"`
+	Message    string `json:"message"`
+	Code       string `json:"code,omitempty"`
+	RetryAfter int64  `json:"retry_after,omitempty"`
+}
+
+// Error is an error that is reported to the client with a machine-readable code.
+// RetryAfter tells the client how long to wait before trying again, if it makes sense.
+type Error struct {
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error returns the human-readable message.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError creates an Error with a code and a human-readable message.
+func NewError(code string, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
 }
 
 // Handler is an abstraction layer to standardize web API returns, if an error happens.
@@ -120,82 +269,104 @@ type Handler struct {
 func (fn Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", defaults.ContentType)
 	if status, err := fn.H(fn.C, w, r); err != nil {
+		errorMessage := ErrorMessage{Message: err.Error()}
+		if e, ok := err.(*Error); ok {
+			errorMessage.Code = e.Code
+			if e.RetryAfter > 0 {
+				errorMessage.RetryAfter = int64(math.Ceil(e.RetryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.FormatInt(errorMessage.RetryAfter, 10))
+			}
+		}
 		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(ErrorMessage{err.Error()})
+		json.NewEncoder(w).Encode(errorMessage)
 		log.Printf("%d %s", status, err.Error())
-		if status == http.StatusInternalServerError {
-			fn.C.RaiseBrokenAccountDetails(err.Error())
-		}
 	}
 }
 
-// CheckAndFixAccountDetails checks, if the last run was unsuccessful (node down, wrong parameters)
+// CheckAndFixAccountDetails checks, if the last run of the account was unsuccessful (node down, wrong parameters)
 // and tries to fix the values from the testnet.
-func (ctx *Context) CheckAndFixAccountDetails() (err error) {
+func (ctx *Context) CheckAndFixAccountDetails(acc *Account) (err error) {
 
-	ctx.BrokenFlagMutex.Lock()
-	defer ctx.BrokenFlagMutex.Unlock()
+	acc.BrokenFlagMutex.Lock()
+	defer acc.BrokenFlagMutex.Unlock()
 
-	if ctx.BrokenFlagMutex.GetValueString() == "no" {
+	if acc.BrokenFlagMutex.GetValueString() == "no" {
 		return
 	}
 
-	var httpClient = &http.Client{Timeout: 5 * time.Second}
-	var req *http.Response
-	var rawBody []byte
-
-	req, err = httpClient.Get(fmt.Sprintf("%s/accounts/%s", ctx.Cfg.LCDNode, ctx.Cfg.AccountAddress))
+	accountDetails, err := ctx.GetAccountDetails(acc.Address)
 	if err != nil {
 		return
 	}
-	defer req.Body.Close()
 
-	if req.StatusCode == http.StatusOK {
-		rawBody, err = ioutil.ReadAll(req.Body)
-		if err != nil {
-			return
-		}
-	} else {
-		return errors.New(fmt.Sprintf("http error code %d calling LCD URL", req.StatusCode))
-	}
+	acc.SequenceMutex.Lock()
+	acc.SequenceMutex.SetValueInt64(accountDetails.GetSequence())
+	acc.SequenceMutex.Unlock()
 
-	var accountDetails auth.Account
-	err = ctx.Cdc.UnmarshalJSON(rawBody, &accountDetails)
-	if err != nil {
-		return
-	}
-
-	ctx.SequenceMutex.Lock()
-	ctx.SequenceMutex.SetValueInt64(accountDetails.GetSequence())
-	ctx.SequenceMutex.Unlock()
+	acc.AccountNumberMutex.Lock()
+	acc.AccountNumberMutex.SetValueInt64(accountDetails.GetAccountNumber())
+	acc.AccountNumberMutex.Unlock()
 
-	ctx.AccountNumberMutex.Lock()
-	ctx.AccountNumberMutex.SetValueInt64(accountDetails.GetAccountNumber())
-	ctx.AccountNumberMutex.Unlock()
+	acc.SetBalance(accountDetails.GetCoins())
 
 	// Reset broken flag
-	ctx.BrokenFlagMutex.SetValueString("no")
+	acc.BrokenFlagMutex.SetValueString("no")
 	return
 
 }
 
-// RaiseBrokenAccountDetails raises the flag that the configuration is broken (parameter change, node timeout).
-func (ctx *Context) RaiseBrokenAccountDetails(message string) {
+// GetAccountDetails reads the details (sequence, account number, coins) of an account from the testnet,
+// see NewAccountReader.
+func (ctx *Context) GetAccountDetails(address sdk.AccAddress) (accountDetails auth.Account, err error) {
+	return ctx.AccountReader.ReadAccount(address)
+}
+
+// EncodeAddress returns the bech32 form of an address with the account prefix of the testnet.
+// Without ACCOUNTPREFIX the default prefix of the SDK is used.
+func (ctx *Context) EncodeAddress(address sdk.AccAddress) (string, error) {
+	if ctx.Cfg.AccountPrefix == "" {
+		return address.String(), nil
+	}
+	return bech32.ConvertAndEncode(ctx.Cfg.AccountPrefix, address.Bytes())
+}
+
+// RaiseBrokenAccountDetails raises the flag that the configuration of the account is broken (parameter change, node timeout).
+func (ctx *Context) RaiseBrokenAccountDetails(acc *Account, message string) {
 	if message == "no" {
 		message = ""
 	}
-	ctx.BrokenFlagMutex.Lock()
-	ctx.BrokenFlagMutex.SetValueString(message)
-	ctx.BrokenFlagMutex.Unlock()
+	acc.BrokenFlagMutex.Lock()
+	acc.BrokenFlagMutex.SetValueString(message)
+	acc.BrokenFlagMutex.Unlock()
 }
 
-// GetTestnetName returns the testnet name from the node
+// GetTestnetName reads the testnet name from the node and makes it the name of the current testnet.
 func (ctx *Context) GetTestnetName() (err error) {
+	name, err := ctx.readTestnetName()
+	if err != nil {
+		return
+	}
+	ctx.SetTestnetName(name)
+	return
+}
+
+// readTestnetName returns the testnet name from the node. If the node fails, the next NODE endpoint is asked.
+// With CHAINID, nodes on other networks are skipped.
+func (ctx *Context) readTestnetName() (name string, err error) {
+	err = ctx.Nodes.Do(func(node string) (nodeErr error) {
+		name, nodeErr = ctx.getTestnetName(node)
+		return
+	})
+	return
+}
+
+// getTestnetName returns the testnet name from the node at node.
+func (ctx *Context) getTestnetName(node string) (name string, err error) {
 	var httpClient = &http.Client{Timeout: 2 * time.Second}
 	var req *http.Response
 	var rawBody []byte
 
-	req, err = httpClient.Get(fmt.Sprintf("%s/status", ctx.Cfg.Node))
+	req, err = httpClient.Get(fmt.Sprintf("%s/status", node))
 	if err != nil {
 		return
 	}
@@ -207,7 +378,7 @@ func (ctx *Context) GetTestnetName() (err error) {
 			return
 		}
 	} else {
-		return errors.New(fmt.Sprintf("http error code %d calling Node URL", req.StatusCode))
+		return "", errors.New(fmt.Sprintf("http error code %d calling Node URL", req.StatusCode))
 	}
 
 	rpcResponse := &rpctypes.RPCResponse{}
@@ -223,9 +394,12 @@ func (ctx *Context) GetTestnetName() (err error) {
 	}
 
 	if resultStatus.NodeInfo.Network == "" {
-		return errors.New("Could not get testnet name from node")
+		return "", errors.New("Could not get testnet name from node")
 	}
-	ctx.TestnetName = resultStatus.NodeInfo.Network
-	return
+	// A node on another network must never receive transactions of the faucet
+	if ctx.Cfg.ChainID != "" && resultStatus.NodeInfo.Network != ctx.Cfg.ChainID {
+		return "", errors.New(fmt.Sprintf("node %s is on network %s, but CHAINID is %s", node, resultStatus.NodeInfo.Network, ctx.Cfg.ChainID))
+	}
+	return resultStatus.NodeInfo.Network, nil
 
 }
@@ -0,0 +1,61 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/tendermint/tendermint/libs/bech32"
+	"time"
+)
+
+// EligibilityErrorBalanceTooHigh is the error code of claims for recipients that hold more than MAXBALANCE.
+const EligibilityErrorBalanceTooHigh = "balance_too_high"
+
+// RecipientBalance returns the balance of a recipient. It is cached in the key-value store for BALANCECACHE
+// seconds, so a burst of claims for the same address does not hammer the node.
+func (ctx *Context) RecipientBalance(encodedAddress string) (balance sdk.Coins, err error) {
+	key := fmt.Sprintf("balance:%s", encodedAddress)
+	cached, found, err := ctx.KV().Get(key)
+	if err != nil {
+		return
+	}
+	if found {
+		return sdk.ParseCoins(cached)
+	}
+
+	_, address, err := bech32.DecodeAndConvert(encodedAddress)
+	if err != nil {
+		return
+	}
+	balance, err = ctx.GetBalance(sdk.AccAddress(address))
+	if err != nil {
+		return
+	}
+
+	if ctx.Cfg.BalanceCache > 0 {
+		err = ctx.KV().Set(key, balance.String(), time.Duration(ctx.Cfg.BalanceCache)*time.Second)
+	}
+	return
+}
+
+// CheckEligibility refuses recipients that hold more than MAXBALANCE in a denomination, so addresses that
+// already have plenty of tokens cannot farm the faucet. Without MAXBALANCE every recipient is eligible.
+func (ctx *Context) CheckEligibility(encodedAddress string) error {
+	if ctx.Cfg.MaxBalance == "" {
+		return nil
+	}
+	maxBalance, err := sdk.ParseCoins(ctx.Cfg.MaxBalance)
+	if err != nil {
+		return err
+	}
+	balance, err := ctx.RecipientBalance(encodedAddress)
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range maxBalance {
+		if balance.AmountOf(limit.Denom).GT(limit.Amount) {
+			return NewError(EligibilityErrorBalanceTooHigh, fmt.Sprintf("%s already holds more than %s", encodedAddress, limit.String()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/bech32"
+	"testing"
+)
+
+// stubAccountReader answers with fixed balances and counts the reads.
+type stubAccountReader struct {
+	balances map[string]sdk.Coins
+	reads    int
+}
+
+func (r *stubAccountReader) ReadAccount(address sdk.AccAddress) (auth.Account, error) {
+	r.reads++
+	coins, ok := r.balances[string(address.Bytes())]
+	if !ok {
+		return nil, &UnknownAccountError{Address: address.String()}
+	}
+	acc := auth.NewBaseAccountWithAddress(address)
+	err := acc.SetCoins(coins)
+	return &acc, err
+}
+
+func TestCheckEligibility(t *testing.T) {
+	rich := make([]byte, 20)
+	rich[0] = 1
+	richAddress, err := bech32.ConvertAndEncode("cosmos", rich)
+	assert.Nil(t, err)
+	newAddress, err := bech32.ConvertAndEncode("cosmos", make([]byte, 20))
+	assert.Nil(t, err)
+
+	reader := &stubAccountReader{balances: map[string]sdk.Coins{
+		string(rich): {sdk.NewInt64Coin("steak", 5000)},
+	}}
+	ctx := New()
+	ctx.AccountReader = reader
+	ctx.Cfg.BalanceCache = 30
+
+	// Everyone is eligible without MAXBALANCE
+	assert.Nil(t, ctx.CheckEligibility(richAddress))
+	assert.Equal(t, 0, reader.reads)
+
+	ctx.Cfg.MaxBalance = "1000steak"
+	err = ctx.CheckEligibility(richAddress)
+	assert.NotNil(t, err)
+	assert.Equal(t, EligibilityErrorBalanceTooHigh, err.(*Error).Code)
+	assert.Nil(t, ctx.CheckEligibility(newAddress))
+
+	// The balances are cached
+	assert.NotNil(t, ctx.CheckEligibility(richAddress))
+	assert.Nil(t, ctx.CheckEligibility(newAddress))
+	assert.Equal(t, 2, reader.reads)
+}
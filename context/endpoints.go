@@ -0,0 +1,287 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	sdkCtx "github.com/cosmos/cosmos-sdk/client/context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointHealth is the result of the last health check of an endpoint.
+type EndpointHealth struct {
+	URL             string    `json:"url"`
+	Network         string    `json:"network,omitempty"`
+	Reachable       bool      `json:"reachable"`
+	CatchingUp      bool      `json:"catching_up"`
+	LatestHeight    int64     `json:"latest_block_height,omitempty"`
+	LatestBlockTime time.Time `json:"latest_block_time"`
+	Error           string    `json:"error,omitempty"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// Healthy is true if the endpoint answered and is not catching up.
+func (h EndpointHealth) Healthy() bool {
+	return h.Reachable && !h.CatchingUp
+}
+
+// EndpointProbe checks the health of the endpoint at url.
+type EndpointProbe func(client *http.Client, url string) EndpointHealth
+
+// EndpointPool is a list of equivalent endpoints, like the NODE or LCDNODE list. Requests go to the healthiest
+// endpoint and fail over to the next one on errors.
+type EndpointPool struct {
+	// Name is used in logs, like node or lcd.
+	Name string
+
+	probe  EndpointProbe
+	client *http.Client
+	// network is the chain ID the endpoints have to be on, see SetNetwork.
+	network string
+
+	lock      sync.RWMutex
+	endpoints []EndpointHealth
+	// ranked lists the indexes of endpoints, healthiest first.
+	ranked []int
+}
+
+// ParseEndpoints splits a comma-separated list of endpoint URLs.
+func ParseEndpoints(list string) (urls []string) {
+	for _, url := range strings.Split(list, ",") {
+		url = strings.TrimRight(strings.TrimSpace(url), "/")
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return
+}
+
+// NewEndpointPool creates a pool of endpoints. Until the first health check they are used in the given order.
+func NewEndpointPool(name string, urls []string, probe EndpointProbe) *EndpointPool {
+	pool := &EndpointPool{
+		Name:   name,
+		probe:  probe,
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+	for i, url := range urls {
+		pool.endpoints = append(pool.endpoints, EndpointHealth{URL: url, Reachable: true})
+		pool.ranked = append(pool.ranked, i)
+	}
+	return pool
+}
+
+// Current returns the URL of the healthiest endpoint.
+func (p *EndpointPool) Current() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if len(p.ranked) == 0 {
+		return ""
+	}
+	return p.endpoints[p.ranked[0]].URL
+}
+
+// Status returns the health of all endpoints, healthiest first.
+func (p *EndpointPool) Status() []EndpointHealth {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	status := make([]EndpointHealth, 0, len(p.ranked))
+	for _, i := range p.ranked {
+		status = append(status, p.endpoints[i])
+	}
+	return status
+}
+
+// Do calls fn with the endpoints, healthiest first, until it succeeds. An endpoint that fails is ranked last
+// until its next health check. The error of the last endpoint is returned if all of them fail.
+func (p *EndpointPool) Do(fn func(url string) error) (err error) {
+	urls := make([]string, 0)
+	for _, endpoint := range p.Status() {
+		urls = append(urls, endpoint.URL)
+	}
+	if len(urls) == 0 {
+		return errors.New(fmt.Sprintf("no %s endpoint configured", p.Name))
+	}
+	for _, url := range urls {
+		err = fn(url)
+		if err == nil {
+			return
+		}
+		p.Fail(url, err)
+	}
+	return
+}
+
+// Fail marks an endpoint unreachable after a failed request, so the next request goes to another endpoint.
+func (p *EndpointPool) Fail(url string, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i := range p.endpoints {
+		if p.endpoints[i].URL == url {
+			p.endpoints[i].Reachable = false
+			p.endpoints[i].Error = err.Error()
+		}
+	}
+	p.rank()
+}
+
+// SetNetwork sets the chain ID the endpoints have to be on. Endpoints on another network are ranked last.
+func (p *EndpointPool) SetNetwork(network string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.network = network
+}
+
+// Check probes all endpoints and ranks them.
+func (p *EndpointPool) Check() {
+	p.lock.RLock()
+	network := p.network
+	p.lock.RUnlock()
+
+	results := make([]EndpointHealth, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range p.Status() {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = p.probe(p.client, url)
+			results[i].URL = url
+			results[i].CheckedAt = time.Now()
+			if network != "" && results[i].Network != "" && results[i].Network != network {
+				results[i].Reachable = false
+				results[i].Error = fmt.Sprintf("endpoint is on network %s, expected %s", results[i].Network, network)
+			}
+		}(i, endpoint.URL)
+	}
+	wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, result := range results {
+		for i := range p.endpoints {
+			if p.endpoints[i].URL == result.URL {
+				p.endpoints[i] = result
+			}
+		}
+	}
+	p.rank()
+}
+
+// Run checks the endpoints every interval until stop is closed.
+func (p *EndpointPool) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.Check()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rank sorts the endpoints: healthy ones first, then the ones with the newest block, then in configuration order.
+// The caller holds the lock.
+func (p *EndpointPool) rank() {
+	if len(p.ranked) == 0 {
+		return
+	}
+	previous := p.endpoints[p.ranked[0]].URL
+
+	ranked := make([]int, len(p.endpoints))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		ea, eb := p.endpoints[ranked[a]], p.endpoints[ranked[b]]
+		if ea.Healthy() != eb.Healthy() {
+			return ea.Healthy()
+		}
+		if ea.Reachable != eb.Reachable {
+			return ea.Reachable
+		}
+		return ea.LatestBlockTime.After(eb.LatestBlockTime)
+	})
+	p.ranked = ranked
+
+	current := p.endpoints[p.ranked[0]]
+	if current.URL != previous {
+		log.Printf("%s endpoint switched from %s to %s (healthy: %v)", p.Name, previous, current.URL, current.Healthy())
+	}
+}
+
+// NodeContext returns the CLIContext connected to the node at url. The contexts are created once per node,
+// so connections are reused.
+func (ctx *Context) NodeContext(url string) *sdkCtx.CLIContext {
+	if cliContext, ok := ctx.nodeContexts.Load(url); ok {
+		return cliContext.(*sdkCtx.CLIContext)
+	}
+	cliContext := ctx.CLIContext.WithNodeURI(url)
+	actual, _ := ctx.nodeContexts.LoadOrStore(url, &cliContext)
+	return actual.(*sdkCtx.CLIContext)
+}
+
+// ProbeNode checks a Tendermint RPC endpoint with /status.
+func ProbeNode(client *http.Client, url string) (health EndpointHealth) {
+	body, err := getEndpoint(client, url+"/status")
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+
+	var status struct {
+		Result struct {
+			NodeInfo struct {
+				Network string `json:"network"`
+			} `json:"node_info"`
+			SyncInfo struct {
+				LatestBlockHeight int64     `json:"latest_block_height,string"`
+				LatestBlockTime   time.Time `json:"latest_block_time"`
+				CatchingUp        bool      `json:"catching_up"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+
+	health.Reachable = true
+	health.Network = status.Result.NodeInfo.Network
+	health.CatchingUp = status.Result.SyncInfo.CatchingUp
+	health.LatestHeight = status.Result.SyncInfo.LatestBlockHeight
+	health.LatestBlockTime = status.Result.SyncInfo.LatestBlockTime
+	return
+}
+
+// ProbeLCD checks a light client daemon endpoint with /syncing.
+func ProbeLCD(client *http.Client, url string) (health EndpointHealth) {
+	body, err := getEndpoint(client, url+"/syncing")
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+	health.Reachable = true
+	health.CatchingUp = strings.TrimSpace(string(body)) == "true"
+	return
+}
+
+// getEndpoint reads the body of a successful GET request.
+func getEndpoint(client *http.Client, url string) ([]byte, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("http error code %d calling %s", res.StatusCode, url))
+	}
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,65 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newStatusServer(network string, catchingUp bool, blockTime time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"node_info":{"network":"%s"},"sync_info":{"latest_block_height":"42","latest_block_time":"%s","catching_up":%v}}}`,
+			network, blockTime.Format(time.RFC3339Nano), catchingUp)
+	}))
+}
+
+func TestEndpointPoolRanking(t *testing.T) {
+	now := time.Now()
+	catchingUp := newStatusServer("test-chain", true, now)
+	defer catchingUp.Close()
+	behind := newStatusServer("test-chain", false, now.Add(-time.Minute))
+	defer behind.Close()
+	latest := newStatusServer("test-chain", false, now)
+	defer latest.Close()
+	wrongNetwork := newStatusServer("other-chain", false, now.Add(time.Minute))
+	defer wrongNetwork.Close()
+
+	pool := NewEndpointPool("node", []string{"http://127.0.0.1:1", wrongNetwork.URL, catchingUp.URL, behind.URL, latest.URL}, ProbeNode)
+	pool.SetNetwork("test-chain")
+	assert.Equal(t, "http://127.0.0.1:1", pool.Current())
+
+	pool.Check()
+	assert.Equal(t, latest.URL, pool.Current())
+
+	status := pool.Status()
+	assert.Equal(t, []string{latest.URL, behind.URL, catchingUp.URL, wrongNetwork.URL, "http://127.0.0.1:1"},
+		[]string{status[0].URL, status[1].URL, status[2].URL, status[3].URL, status[4].URL})
+	assert.Equal(t, int64(42), status[0].LatestHeight)
+	assert.Equal(t, "test-chain", status[0].Network)
+	assert.True(t, status[2].CatchingUp)
+	assert.False(t, status[3].Reachable)
+	assert.False(t, status[4].Reachable)
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	pool := NewEndpointPool("lcd", ParseEndpoints("http://a/, http://b"), ProbeLCD)
+
+	var tried []string
+	err := pool.Do(func(url string) error {
+		tried = append(tried, url)
+		if url == "http://a" {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://a", "http://b"}, tried)
+	assert.Equal(t, "http://b", pool.Current())
+
+	err = NewEndpointPool("lcd", nil, ProbeLCD).Do(func(url string) error { return nil })
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/pkg/errors"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// gasPricePattern matches one gas price, like 0.025steak.
+var gasPricePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z][a-zA-Z0-9/]*)$`)
+
+// GasPrice is the price of one unit of gas in a denomination.
+type GasPrice struct {
+	Denom  string
+	Amount *big.Rat
+}
+
+// ParseGasPrices parses a comma-separated list of gas prices, like 0.025steak,0.1photino. The result is sorted by denomination.
+func ParseGasPrices(gasPrices string) ([]GasPrice, error) {
+	var prices []GasPrice
+	for _, price := range strings.Split(gasPrices, ",") {
+		price = strings.TrimSpace(price)
+		if price == "" {
+			continue
+		}
+		match := gasPricePattern.FindStringSubmatch(price)
+		if match == nil {
+			return nil, errors.New(fmt.Sprintf("invalid gas price %s", price))
+		}
+		amount, ok := new(big.Rat).SetString(match[1])
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid gas price %s", price))
+		}
+		prices = append(prices, GasPrice{Denom: match[2], Amount: amount})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Denom < prices[j].Denom })
+	return prices, nil
+}
+
+// TxFee returns the fee of a transaction that uses gas: the fixed FEES, or GASPRICES times gas rounded up.
+// Without FEES and GASPRICES transactions are free.
+func (ctx *Context) TxFee(gas int64) (sdk.Coins, error) {
+	if ctx.Cfg.Fees != "" && ctx.Cfg.GasPrices != "" {
+		return nil, errors.New("set either FEES or GASPRICES, not both")
+	}
+
+	if ctx.Cfg.Fees != "" {
+		return sdk.ParseCoins(ctx.Cfg.Fees)
+	}
+
+	prices, err := ParseGasPrices(ctx.Cfg.GasPrices)
+	if err != nil {
+		return nil, err
+	}
+	fees := sdk.Coins{}
+	for _, price := range prices {
+		amount := new(big.Rat).Mul(price.Amount, new(big.Rat).SetInt64(gas))
+		// Round up, a fee below the minimum is rejected
+		quotient, remainder := new(big.Int).QuoRem(amount.Num(), amount.Denom(), new(big.Int))
+		if remainder.Sign() > 0 {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+		if quotient.Sign() == 0 {
+			continue
+		}
+		fees = append(fees, sdk.NewCoin(price.Denom, sdk.NewIntFromBigInt(quotient)))
+	}
+	return fees, nil
+}
+
+// TxGas returns the gas limit of a transaction: GAS for every message, or the simulated gas usage times GASADJUSTMENT.
+func (ctx *Context) TxGas(msgCount int, simulatedGas int64) int64 {
+	if simulatedGas > 0 {
+		return int64(float64(simulatedGas) * ctx.Cfg.GasAdjustment)
+	}
+	return ctx.Cfg.Gas * int64(msgCount)
+}
@@ -0,0 +1,43 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTxFee(t *testing.T) {
+	ctx := New()
+
+	fees, err := ctx.TxFee(20000)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(fees))
+
+	ctx.Cfg.GasPrices = "0.025steak,0.00001photino"
+	fees, err = ctx.TxFee(20001)
+	assert.Nil(t, err)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("photino", 1), sdk.NewInt64Coin("steak", 501)}, fees)
+
+	ctx.Cfg.Fees = "10steak"
+	_, err = ctx.TxFee(20000)
+	assert.NotNil(t, err)
+
+	ctx.Cfg.GasPrices = ""
+	fees, err = ctx.TxFee(20000)
+	assert.Nil(t, err)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 10)}, fees)
+
+	ctx.Cfg.Fees = ""
+	ctx.Cfg.GasPrices = "cheap"
+	_, err = ctx.TxFee(20000)
+	assert.NotNil(t, err)
+}
+
+func TestTxGas(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Gas = 20000
+	ctx.Cfg.GasAdjustment = 1.5
+
+	assert.Equal(t, int64(60000), ctx.TxGas(3, 0))
+	assert.Equal(t, int64(45000), ctx.TxGas(3, 30000))
+}
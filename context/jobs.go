@@ -0,0 +1,173 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Claim job states
+const (
+	JobQueued       = "queued"
+	JobBroadcasting = "broadcasting"
+	JobCommitted    = "committed"
+	JobFailed       = "failed"
+)
+
+// jobQueueKey is the list of claim job IDs waiting to be processed. New jobs are inserted in front,
+// workers take them from the end.
+const jobQueueKey = "jobqueue"
+
+// jobProcessingKey is the list of claim job IDs taken by a worker and not finished yet.
+// A job stays there if its worker dies, until RequeueStaleClaimJobs finds it.
+const jobProcessingKey = "jobprocessing"
+
+// jobStaleMargin is added to the longest time a worker can take for a claim job, see jobStaleAfter.
+const jobStaleMargin = 5 * time.Minute
+
+// jobTTL is how long claim jobs can be queried after their last update.
+const jobTTL = 24 * time.Hour
+
+// ClaimJob is a claim that is processed asynchronously. It is stored in the key-value store
+// so every instance can answer status queries about it.
+type ClaimJob struct {
+	ID      string    `json:"id"`
+	Address string    `json:"address"`
+	IP      string    `json:"ip"`
+	Status  string    `json:"status"`
+	Hash    string    `json:"hash,omitempty"`
+	Height  int64     `json:"height,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+func jobKey(id string) string {
+	return fmt.Sprintf("job:%s", id)
+}
+
+// EnqueueClaimJob creates a queued claim job for an address and puts it in the job queue.
+func (ctx *Context) EnqueueClaimJob(address string, ip string) (job *ClaimJob, err error) {
+	id, err := NewRandomID()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	job = &ClaimJob{
+		ID:      id,
+		Address: address,
+		IP:      ip,
+		Status:  JobQueued,
+		Created: now,
+		Updated: now,
+	}
+	err = ctx.SaveClaimJob(job)
+	if err != nil {
+		return
+	}
+	err = ctx.KV().PushFront(jobQueueKey, id)
+	return
+}
+
+// SaveClaimJob stores the current state of a claim job.
+func (ctx *Context) SaveClaimJob(job *ClaimJob) error {
+	job.Updated = time.Now()
+	bz, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return ctx.KV().Set(jobKey(job.ID), string(bz), jobTTL)
+}
+
+// GetClaimJob returns a claim job. found is false if the job does not exist or expired.
+func (ctx *Context) GetClaimJob(id string) (job *ClaimJob, found bool, err error) {
+	value, found, err := ctx.KV().Get(jobKey(id))
+	if err != nil || !found {
+		return
+	}
+	job = &ClaimJob{}
+	err = json.Unmarshal([]byte(value), job)
+	return
+}
+
+// NextClaimJob takes the next claim job from the job queue. It waits up to timeout for a job to arrive.
+// job is nil if there was no job in the queue. The job is kept in the processing list until FinishClaimJob,
+// so it is not lost if the worker dies.
+func (ctx *Context) NextClaimJob(timeout time.Duration) (job *ClaimJob, err error) {
+	id, found, err := ctx.KV().Move(jobQueueKey, jobProcessingKey, timeout)
+	if err != nil || !found {
+		return
+	}
+	job, found, err = ctx.GetClaimJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// The job expired while it was queued
+		return nil, ctx.FinishClaimJob(id)
+	}
+	return
+}
+
+// FinishClaimJob removes a claim job from the processing list once it is committed or failed.
+func (ctx *Context) FinishClaimJob(id string) error {
+	_, err := ctx.KV().Remove(jobProcessingKey, id)
+	return err
+}
+
+// jobStaleAfter is how long a taken job can go without an update before it is considered abandoned. A worker waits
+// up to TIMEOUT seconds for an account, BATCHWINDOW for its batch and the expiry of the sequence mutex for the sequence
+// number, then broadcasts up to 1+SEQUENCERETRIES times, each of them as long as the sequence mutex can be held.
+func (ctx *Context) jobStaleAfter() time.Duration {
+	sequenceExpiry := ctx.sequenceLockExpiry()
+	return time.Duration(ctx.Cfg.Timeout)*time.Second +
+		time.Duration(ctx.Cfg.BatchWindow)*time.Millisecond +
+		sequenceExpiry +
+		time.Duration(1+ctx.Cfg.SequenceRetries)*sequenceExpiry +
+		jobStaleMargin
+}
+
+// RequeueStaleClaimJobs looks for jobs in the processing list that were not updated for a while, because
+// their worker died. A job that was not started yet goes back to the job queue. A job that was broadcasting
+// fails: its transaction might have landed, so sending the tokens again could pay the address twice.
+func (ctx *Context) RequeueStaleClaimJobs() (requeued int, err error) {
+	ids, err := ctx.KV().List(jobProcessingKey)
+	if err != nil {
+		return
+	}
+	staleAfter := ctx.jobStaleAfter()
+	for _, id := range ids {
+		job, found, getErr := ctx.GetClaimJob(id)
+		if getErr != nil {
+			return requeued, getErr
+		}
+		if found && job.Status != JobCommitted && job.Status != JobFailed && time.Since(job.Updated) < staleAfter {
+			continue
+		}
+
+		// Only the sweeper that removes the entry handles it, in case several of them run
+		removed, removeErr := ctx.KV().Remove(jobProcessingKey, id)
+		if removeErr != nil {
+			return requeued, removeErr
+		}
+		if !removed || !found {
+			continue
+		}
+		switch job.Status {
+		case JobQueued:
+			err = ctx.KV().Push(jobQueueKey, id, 0, 0)
+			if err != nil {
+				return
+			}
+			requeued++
+		case JobBroadcasting:
+			job.Status = JobFailed
+			job.Error = "the claim worker stopped while sending the tokens, the transaction might still land"
+			err = ctx.SaveClaimJob(job)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
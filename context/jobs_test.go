@@ -0,0 +1,113 @@
+package context
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// abandonClaimJob stores a job as if its worker died an hour ago.
+func abandonClaimJob(t *testing.T, ctx *Context, job *ClaimJob, status string) {
+	job.Status = status
+	job.Updated = time.Now().Add(-time.Hour)
+	bz, err := json.Marshal(job)
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.KV().Set(jobKey(job.ID), string(bz), jobTTL))
+}
+
+func TestClaimJobQueue(t *testing.T) {
+	ctx := New()
+	first, err := ctx.EnqueueClaimJob("cosmos1first", "1.2.3.4")
+	assert.Nil(t, err)
+	second, err := ctx.EnqueueClaimJob("cosmos1second", "1.2.3.4")
+	assert.Nil(t, err)
+
+	// Jobs are processed in order and kept until they are finished
+	job, err := ctx.NextClaimJob(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID, job.ID)
+	processing, err := ctx.KV().List(jobProcessingKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{first.ID}, processing)
+
+	assert.Nil(t, ctx.FinishClaimJob(first.ID))
+	processing, err = ctx.KV().List(jobProcessingKey)
+	assert.Nil(t, err)
+	assert.Empty(t, processing)
+
+	job, err = ctx.NextClaimJob(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, second.ID, job.ID)
+	job, err = ctx.NextClaimJob(100 * time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+}
+
+func TestRequeueStaleClaimJobs(t *testing.T) {
+	ctx := New()
+	queued, err := ctx.EnqueueClaimJob("cosmos1queued", "1.2.3.4")
+	assert.Nil(t, err)
+	broadcasting, err := ctx.EnqueueClaimJob("cosmos1broadcasting", "1.2.3.4")
+	assert.Nil(t, err)
+	busy, err := ctx.EnqueueClaimJob("cosmos1busy", "1.2.3.4")
+	assert.Nil(t, err)
+	for range []*ClaimJob{queued, broadcasting, busy} {
+		_, err = ctx.NextClaimJob(time.Second)
+		assert.Nil(t, err)
+	}
+
+	// Jobs of running workers stay where they are
+	requeued, err := ctx.RequeueStaleClaimJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, requeued)
+
+	abandonClaimJob(t, ctx, queued, JobQueued)
+	abandonClaimJob(t, ctx, broadcasting, JobBroadcasting)
+	requeued, err = ctx.RequeueStaleClaimJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requeued)
+
+	processing, err := ctx.KV().List(jobProcessingKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{busy.ID}, processing)
+
+	job, err := ctx.NextClaimJob(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, queued.ID, job.ID)
+
+	// A job that might have sent its transaction is not sent again
+	job, found, err := ctx.GetClaimJob(broadcasting.ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, JobFailed, job.Status)
+}
+
+func TestClaimJobStaleAfter(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.Timeout = 60
+	ctx.Cfg.SequenceRetries = 3
+	ctx.Cfg.BroadcastRetries = 2
+	staleAfter := ctx.jobStaleAfter()
+
+	// A worker with slow broadcasts is not taken for dead
+	job, err := ctx.EnqueueClaimJob("cosmos1slow", "1.2.3.4")
+	assert.Nil(t, err)
+	_, err = ctx.NextClaimJob(time.Second)
+	assert.Nil(t, err)
+	job.Status = JobBroadcasting
+	job.Updated = time.Now().Add(-20 * time.Minute)
+	bz, err := json.Marshal(job)
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.KV().Set(jobKey(job.ID), string(bz), jobTTL))
+	assert.True(t, staleAfter > 20*time.Minute)
+	_, err = ctx.RequeueStaleClaimJobs()
+	assert.Nil(t, err)
+	job, _, err = ctx.GetClaimJob(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, JobBroadcasting, job.Status)
+
+	// More retries give the worker more time
+	ctx.Cfg.SequenceRetries = 5
+	assert.True(t, ctx.jobStaleAfter() > staleAfter)
+}
@@ -0,0 +1,381 @@
+package context
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KVStore is a key-value store for faucet state that has to be shared between processes, like the claim ledger.
+// It lives in the same backend as the rate limiter store: RedisDB or, with --no-rdb, process memory.
+// A zero ttl means the key does not expire.
+type KVStore interface {
+	// Get returns the value of a key. found is false if the key does not exist or expired.
+	Get(key string) (value string, found bool, err error)
+	// Set stores the value of a key.
+	Set(key string, value string, ttl time.Duration) error
+	// SetIfNotExists stores the value of a key, if the key does not exist yet. ok is false if it already existed.
+	SetIfNotExists(key string, value string, ttl time.Duration) (ok bool, err error)
+	// Delete removes a key.
+	Delete(key string) error
+	// Increment adds one to the counter stored at key and returns the new value. ttl is set when the counter is created.
+	Increment(key string, ttl time.Duration) (int64, error)
+	// IncrementBy adds amount to the counter stored at key and returns the new value. ttl is set when the counter is created.
+	IncrementBy(key string, amount int64, ttl time.Duration) (int64, error)
+	// IncrementByDecimal adds the decimal integer amount to the counter stored at key and returns the new value.
+	// Unlike IncrementBy it is exact for token amounts of any size. ttl is set when the counter is created.
+	IncrementByDecimal(key string, amount string, ttl time.Duration) (string, error)
+	// Push appends a value to the list stored at key and keeps only the last maxLen values (0 keeps everything).
+	// A non-zero ttl restarts the expiry of the list.
+	Push(key string, value string, maxLen int64, ttl time.Duration) error
+	// PushFront inserts a value in front of the list stored at key.
+	PushFront(key string, value string) error
+	// Move removes the last value of the list stored at source, inserts it in front of the list stored at
+	// destination and returns it. It waits up to timeout for a value.
+	Move(source string, destination string, timeout time.Duration) (value string, found bool, err error)
+	// Remove removes a value from the list stored at key. found is false if the list did not have it.
+	Remove(key string, value string) (found bool, err error)
+	// List returns the values of the list stored at key.
+	List(key string) ([]string, error)
+}
+
+// NewKVStore creates a KVStore for the context: on RedisDB, if a client is set up, in memory otherwise.
+func (ctx *Context) NewKVStore(prefix string) KVStore {
+	if ctx.RedisClient != nil {
+		return NewRedisKVStore(ctx.RedisClient, prefix)
+	}
+	return NewMemKVStore(prefix)
+}
+
+// redisKVStore is a KVStore in RedisDB.
+type redisKVStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisKVStore creates a KVStore in RedisDB. All keys are prefixed with prefix.
+func NewRedisKVStore(client *redis.Client, prefix string) KVStore {
+	return &redisKVStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *redisKVStore) key(key string) string {
+	return fmt.Sprintf("%s:%s", r.prefix, key)
+}
+
+func (r *redisKVStore) Get(key string) (value string, found bool, err error) {
+	value, err = r.client.Get(r.key(key)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *redisKVStore) Set(key string, value string, ttl time.Duration) error {
+	return r.client.Set(r.key(key), value, ttl).Err()
+}
+
+func (r *redisKVStore) SetIfNotExists(key string, value string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(r.key(key), value, ttl).Result()
+}
+
+func (r *redisKVStore) Delete(key string) error {
+	return r.client.Del(r.key(key)).Err()
+}
+
+func (r *redisKVStore) Increment(key string, ttl time.Duration) (int64, error) {
+	return r.IncrementBy(key, 1, ttl)
+}
+
+func (r *redisKVStore) IncrementBy(key string, amount int64, ttl time.Duration) (int64, error) {
+	value, err := r.client.IncrBy(r.key(key), amount).Result()
+	if err != nil {
+		return 0, err
+	}
+	if value == amount && ttl > 0 {
+		err = r.client.Expire(r.key(key), ttl).Err()
+	}
+	return value, err
+}
+
+// IncrementByDecimal reads, adds and writes the counter in a transaction that is retried if the counter changed
+// in the meantime: RedisDB has no exact arithmetic for numbers beyond 64 bits.
+func (r *redisKVStore) IncrementByDecimal(key string, amount string, ttl time.Duration) (value string, err error) {
+	for {
+		err = r.client.Watch(func(tx *redis.Tx) error {
+			current, err := tx.Get(r.key(key)).Result()
+			expiry := ttl
+			if err == redis.Nil {
+				current = "0"
+			} else if err != nil {
+				return err
+			} else {
+				// The counter keeps the expiry it got when it was created
+				expiry, err = tx.PTTL(r.key(key)).Result()
+				if err != nil {
+					return err
+				}
+				if expiry < 0 {
+					expiry = 0
+				}
+			}
+			value, err = addDecimal(current, amount)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(r.key(key), value, expiry)
+				return nil
+			})
+			return err
+		}, r.key(key))
+		if err != redis.TxFailedErr {
+			return
+		}
+	}
+}
+
+func (r *redisKVStore) Push(key string, value string, maxLen int64, ttl time.Duration) error {
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(r.key(key), value)
+		if maxLen > 0 {
+			pipe.LTrim(r.key(key), -maxLen, -1)
+		}
+		if ttl > 0 {
+			pipe.Expire(r.key(key), ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *redisKVStore) PushFront(key string, value string) error {
+	return r.client.LPush(r.key(key), value).Err()
+}
+
+func (r *redisKVStore) Move(source string, destination string, timeout time.Duration) (string, bool, error) {
+	value, err := r.client.BRPopLPush(r.key(source), r.key(destination), timeout).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *redisKVStore) Remove(key string, value string) (bool, error) {
+	removed, err := r.client.LRem(r.key(key), 0, value).Result()
+	return removed > 0, err
+}
+
+func (r *redisKVStore) List(key string) ([]string, error) {
+	return r.client.LRange(r.key(key), 0, -1).Result()
+}
+
+// memKVItem is a value stored in memKVStore.
+type memKVItem struct {
+	value   string
+	list    []string
+	expires time.Time
+}
+
+func (i memKVItem) expired() bool {
+	return !i.expires.IsZero() && time.Now().After(i.expires)
+}
+
+// memKVStore is an in-process KVStore for local execution.
+type memKVStore struct {
+	lock   sync.Mutex
+	prefix string
+	items  map[string]memKVItem
+}
+
+// NewMemKVStore creates an in-process KVStore. All keys are prefixed with prefix.
+func NewMemKVStore(prefix string) KVStore {
+	return &memKVStore{
+		prefix: prefix,
+		items:  make(map[string]memKVItem),
+	}
+}
+
+func (m *memKVStore) key(key string) string {
+	return fmt.Sprintf("%s:%s", m.prefix, key)
+}
+
+// get returns a live item. The caller holds the lock.
+func (m *memKVStore) get(key string) (memKVItem, bool) {
+	item, ok := m.items[m.key(key)]
+	if ok && item.expired() {
+		delete(m.items, m.key(key))
+		return memKVItem{}, false
+	}
+	return item, ok
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (m *memKVStore) Get(key string) (string, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.get(key)
+	return item.value, ok, nil
+}
+
+func (m *memKVStore) Set(key string, value string, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.items[m.key(key)] = memKVItem{value: value, expires: expiry(ttl)}
+	return nil
+}
+
+func (m *memKVStore) SetIfNotExists(key string, value string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.items[m.key(key)] = memKVItem{value: value, expires: expiry(ttl)}
+	return true, nil
+}
+
+func (m *memKVStore) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.items, m.key(key))
+	return nil
+}
+
+func (m *memKVStore) Increment(key string, ttl time.Duration) (int64, error) {
+	return m.IncrementBy(key, 1, ttl)
+}
+
+func (m *memKVStore) IncrementBy(key string, amount int64, ttl time.Duration) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		item = memKVItem{value: "0", expires: expiry(ttl)}
+	}
+	value, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	value += amount
+	item.value = strconv.FormatInt(value, 10)
+	m.items[m.key(key)] = item
+	return value, nil
+}
+
+func (m *memKVStore) IncrementByDecimal(key string, amount string, ttl time.Duration) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		item = memKVItem{value: "0", expires: expiry(ttl)}
+	}
+	value, err := addDecimal(item.value, amount)
+	if err != nil {
+		return "", err
+	}
+	item.value = value
+	m.items[m.key(key)] = item
+	return value, nil
+}
+
+// addDecimal adds two decimal integers of any size.
+func addDecimal(a string, b string) (string, error) {
+	x, ok := new(big.Int).SetString(a, 10)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("%s is not a decimal integer", a))
+	}
+	y, ok := new(big.Int).SetString(b, 10)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("%s is not a decimal integer", b))
+	}
+	return x.Add(x, y).String(), nil
+}
+
+func (m *memKVStore) Push(key string, value string, maxLen int64, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, _ := m.get(key)
+	item.list = append(item.list, value)
+	if maxLen > 0 && int64(len(item.list)) > maxLen {
+		item.list = item.list[int64(len(item.list))-maxLen:]
+	}
+	if ttl > 0 {
+		item.expires = expiry(ttl)
+	}
+	m.items[m.key(key)] = item
+	return nil
+}
+
+func (m *memKVStore) PushFront(key string, value string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, _ := m.get(key)
+	item.list = append([]string{value}, item.list...)
+	m.items[m.key(key)] = item
+	return nil
+}
+
+func (m *memKVStore) Move(source string, destination string, timeout time.Duration) (string, bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		m.lock.Lock()
+		item, _ := m.get(source)
+		if len(item.list) > 0 {
+			value := item.list[len(item.list)-1]
+			item.list = item.list[:len(item.list)-1]
+			m.items[m.key(source)] = item
+			target, _ := m.get(destination)
+			target.list = append([]string{value}, target.list...)
+			m.items[m.key(destination)] = target
+			m.lock.Unlock()
+			return value, true, nil
+		}
+		m.lock.Unlock()
+		if time.Now().After(deadline) {
+			return "", false, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (m *memKVStore) Remove(key string, value string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, _ := m.get(key)
+	list := make([]string, 0, len(item.list))
+	for _, v := range item.list {
+		if v != value {
+			list = append(list, v)
+		}
+	}
+	found := len(list) < len(item.list)
+	item.list = list
+	m.items[m.key(key)] = item
+	return found, nil
+}
+
+func (m *memKVStore) List(key string) ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, _ := m.get(key)
+	return append([]string{}, item.list...), nil
+}
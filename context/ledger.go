@@ -0,0 +1,88 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ledgerMaxEntries is the number of claims kept in the ledger of one address.
+const ledgerMaxEntries = 100
+
+// ClaimEntry is a record of a successful claim in the claim ledger.
+type ClaimEntry struct {
+	Address string    `json:"address"`
+	IP      string    `json:"ip"`
+	Amount  string    `json:"amount"`
+	Hash    string    `json:"hash"`
+	Height  int64     `json:"height"`
+	Time    time.Time `json:"time"`
+}
+
+func cooldownKey(address string) string {
+	return fmt.Sprintf("cooldown:%s", address)
+}
+
+func ledgerKey(address string) string {
+	return fmt.Sprintf("ledger:%s", address)
+}
+
+// ReserveClaim starts the cooldown window of an address. If the address is still inside its cooldown window,
+// it returns an Error with the remaining time. A zero CLAIMCOOLDOWN disables the check.
+func (ctx *Context) ReserveClaim(address string) (err error) {
+	cooldown := time.Duration(ctx.Cfg.ClaimCooldown) * time.Second
+	if cooldown <= 0 {
+		return
+	}
+
+	now := time.Now()
+	remaining := cooldown
+	for attempt := 0; attempt < 2; attempt++ {
+		var ok bool
+		ok, err = ctx.KV().SetIfNotExists(cooldownKey(address), strconv.FormatInt(now.Unix(), 10), cooldown)
+		if err != nil || ok {
+			return
+		}
+
+		var value string
+		var found bool
+		value, found, err = ctx.KV().Get(cooldownKey(address))
+		if err != nil {
+			return
+		}
+		if found {
+			var claimed int64
+			claimed, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return
+			}
+			remaining = time.Unix(claimed, 0).Add(cooldown).Sub(now)
+			break
+		}
+		// The cooldown window ended in between, try to start a new one once more
+	}
+	return &Error{
+		Code:       "cooldown",
+		Message:    fmt.Sprintf("address already claimed tokens, try again in %s", remaining.Round(time.Second)),
+		RetryAfter: remaining,
+	}
+}
+
+// ReleaseClaim ends the cooldown window of an address early, because its claim did not go through.
+func (ctx *Context) ReleaseClaim(address string) error {
+	if ctx.Cfg.ClaimCooldown <= 0 {
+		return nil
+	}
+	return ctx.KV().Delete(cooldownKey(address))
+}
+
+// RecordClaim adds a successful claim to the claim ledger of the address. The ledger expires LEDGERRETENTION
+// seconds after the last claim of the address.
+func (ctx *Context) RecordClaim(entry ClaimEntry) error {
+	bz, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ctx.KV().Push(ledgerKey(entry.Address), string(bz), ledgerMaxEntries, time.Duration(ctx.Cfg.LedgerRetention)*time.Second)
+}
@@ -0,0 +1,24 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecordClaimExpires(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.LedgerRetention = 1
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8catxrqxv"
+
+	assert.Nil(t, ctx.RecordClaim(ClaimEntry{Address: address, Amount: "10steak", Time: time.Now()}))
+	entries, err := ctx.KV().List(ledgerKey(address))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	// The ledger of an address expires LEDGERRETENTION seconds after its last claim
+	time.Sleep(1100 * time.Millisecond)
+	entries, err = ctx.KV().List(ledgerKey(address))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,272 @@
+package context
+
+import (
+	"fmt"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/go-redis/redis"
+	ddbsync "github.com/greg-szabo/dsync/ddb/sync"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mutex is a named lock that also carries a small value.
+// The value is how sequence number, account number and broken flag are shared between processes.
+// Lock panics if the lock could not be acquired within the timeout. TryLock does not wait, it returns false
+// if the lock is held by someone else.
+type Mutex interface {
+	Lock()
+	TryLock() bool
+	Unlock()
+	GetValueInt64() int64
+	SetValueInt64(value int64)
+	GetValueString() string
+	SetValueString(value string)
+}
+
+// NewMutex creates a Mutex on the lock backend selected in the configuration.
+func (ctx *Context) NewMutex(name string, expiry time.Duration, timeout time.Duration) (Mutex, error) {
+	switch ctx.Cfg.LockBackend {
+	case "", defaults.LockBackendDynamoDB:
+		return NewDDBMutex(name, ctx.Cfg.AWSRegion, expiry, timeout), nil
+	case defaults.LockBackendRedis:
+		if ctx.RedisClient == nil {
+			return nil, errors.New("redis lock backend needs RedisDB, do not use it with -no-rdb")
+		}
+		return NewRedisMutex(ctx.RedisClient, name, expiry, timeout), nil
+	case defaults.LockBackendMemory:
+		return NewMemMutex(name), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown lock backend %s", ctx.Cfg.LockBackend))
+	}
+}
+
+// ddbMutex is a distributed Mutex stored in AWS DynamoDB.
+type ddbMutex struct {
+	m ddbsync.Mutex
+
+	// try is the same lock with a timeout short enough for a single attempt, see TryLock
+	try ddbsync.Mutex
+}
+
+// NewDDBMutex creates a Mutex that is stored in the DynamoDB Locks table of the given AWS region.
+func NewDDBMutex(name string, awsRegion string, expiry time.Duration, timeout time.Duration) Mutex {
+	return &ddbMutex{
+		m: ddbsync.Mutex{
+			Name:      name,
+			AWSRegion: awsRegion,
+			Expiry:    expiry,
+		}.WithTimeout(timeout),
+		try: ddbsync.Mutex{
+			Name:      name,
+			AWSRegion: awsRegion,
+			Expiry:    expiry,
+		}.WithTimeout(time.Millisecond),
+	}
+}
+
+func (d *ddbMutex) Lock()                       { d.m.Lock() }
+func (d *ddbMutex) Unlock()                     { d.m.Unlock() }
+func (d *ddbMutex) TryLock() bool               { return tryLock(d.try.Lock) }
+func (d *ddbMutex) GetValueInt64() int64        { return d.m.GetValueInt64() }
+func (d *ddbMutex) SetValueInt64(value int64)   { d.m.SetValueInt64(value) }
+func (d *ddbMutex) GetValueString() string      { return d.m.GetValueString() }
+func (d *ddbMutex) SetValueString(value string) { d.m.SetValueString(value) }
+
+// tryLock calls lock and tells if it acquired the lock. A lock that times out panics.
+func tryLock(lock func()) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	lock()
+	return true
+}
+
+// memMutexes holds all in-process mutexes so the same name always refers to the same lock and value.
+var memMutexes = struct {
+	sync.Mutex
+	m map[string]*memMutex
+}{m: make(map[string]*memMutex)}
+
+// memMutex is an in-process Mutex. It only synchronizes goroutines of the current process.
+type memMutex struct {
+	// lock holds a token while the mutex is locked, so it can be tried without waiting
+	lock chan struct{}
+
+	valueLock sync.RWMutex
+	value     string
+}
+
+// NewMemMutex returns the in-process Mutex with the given name, creating it if necessary.
+func NewMemMutex(name string) Mutex {
+	memMutexes.Lock()
+	defer memMutexes.Unlock()
+	m, ok := memMutexes.m[name]
+	if !ok {
+		m = &memMutex{lock: make(chan struct{}, 1)}
+		memMutexes.m[name] = m
+	}
+	return m
+}
+
+func (m *memMutex) Lock()   { m.lock <- struct{}{} }
+func (m *memMutex) Unlock() { <-m.lock }
+
+func (m *memMutex) TryLock() bool {
+	select {
+	case m.lock <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *memMutex) GetValueString() string {
+	m.valueLock.RLock()
+	defer m.valueLock.RUnlock()
+	return m.value
+}
+
+func (m *memMutex) SetValueString(value string) {
+	m.valueLock.Lock()
+	m.value = value
+	m.valueLock.Unlock()
+}
+
+func (m *memMutex) GetValueInt64() int64 {
+	value, _ := strconv.ParseInt(m.GetValueString(), 10, 64)
+	return value
+}
+
+func (m *memMutex) SetValueInt64(value int64) {
+	m.SetValueString(strconv.FormatInt(value, 10))
+}
+
+// redisUnlockScript deletes the lock key only if it is still owned by the caller.
+const redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// redisSetScript sets the value key only if the lock key is still owned by the caller.
+const redisSetScript = `if redis.call("get", KEYS[1]) == ARGV[1] then redis.call("set", KEYS[2], ARGV[2]) return 1 else return 0 end`
+
+// redisMutex is a distributed Mutex stored in RedisDB.
+// While the lock is held, the value read when it was acquired is kept for subsequent reads, like the DynamoDB Mutex.
+// Without the lock, the value is read from RedisDB. It is only written while the lock is still owned.
+type redisMutex struct {
+	client  *redis.Client
+	name    string
+	expiry  time.Duration
+	timeout time.Duration
+
+	// lock protects token and value, the Mutex is shared by the goroutines of the process
+	lock  sync.Mutex
+	token string
+	value string
+}
+
+// NewRedisMutex creates a Mutex that is stored in RedisDB under the given name.
+func NewRedisMutex(client *redis.Client, name string, expiry time.Duration, timeout time.Duration) Mutex {
+	return &redisMutex{
+		client:  client,
+		name:    name,
+		expiry:  expiry,
+		timeout: timeout,
+	}
+}
+
+func (r *redisMutex) lockKey() string {
+	return fmt.Sprintf("%s:lock", r.name)
+}
+
+func (r *redisMutex) valueKey() string {
+	return fmt.Sprintf("%s:value", r.name)
+}
+
+// readValue reads the value from RedisDB, empty if it was never set.
+func (r *redisMutex) readValue() string {
+	value, err := r.client.Get(r.valueKey()).Result()
+	if err != nil && err != redis.Nil {
+		panic(err)
+	}
+	return value
+}
+
+// acquire makes a single attempt to take the lock with token.
+func (r *redisMutex) acquire(token string) bool {
+	ok, err := r.client.SetNX(r.lockKey(), token, r.expiry).Result()
+	if err != nil || !ok {
+		return false
+	}
+
+	value := r.readValue()
+	r.lock.Lock()
+	r.token, r.value = token, value
+	r.lock.Unlock()
+	return true
+}
+
+func (r *redisMutex) Lock() {
+	token, err := NewRandomID()
+	if err != nil {
+		panic(err)
+	}
+
+	deadline := time.Now().Add(r.timeout)
+	for !r.acquire(token) {
+		if time.Now().After(deadline) {
+			panic(fmt.Sprintf("could not acquire lock %s in %s", r.name, r.timeout))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (r *redisMutex) TryLock() bool {
+	token, err := NewRandomID()
+	if err != nil {
+		panic(err)
+	}
+	return r.acquire(token)
+}
+
+func (r *redisMutex) Unlock() {
+	r.lock.Lock()
+	token := r.token
+	r.token, r.value = "", ""
+	r.lock.Unlock()
+	r.client.Eval(redisUnlockScript, []string{r.lockKey()}, token)
+}
+
+func (r *redisMutex) GetValueString() string {
+	r.lock.Lock()
+	token, value := r.token, r.value
+	r.lock.Unlock()
+	if token == "" {
+		return r.readValue()
+	}
+	return value
+}
+
+func (r *redisMutex) SetValueString(value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	owned, err := r.client.Eval(redisSetScript, []string{r.lockKey(), r.valueKey()}, r.token, value).Int64()
+	if err != nil {
+		panic(err)
+	}
+	if owned == 0 {
+		// The lock expired or was never acquired, another process might have changed the value since
+		panic(fmt.Sprintf("could not set the value of lock %s: the lock is not owned", r.name))
+	}
+	r.value = value
+}
+
+func (r *redisMutex) GetValueInt64() int64 {
+	value, _ := strconv.ParseInt(r.GetValueString(), 10, 64)
+	return value
+}
+
+func (r *redisMutex) SetValueInt64(value int64) {
+	r.SetValueString(strconv.FormatInt(value, 10))
+}
@@ -0,0 +1,52 @@
+package context
+
+import (
+	"github.com/cosmos/faucet-backend/config"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemMutexSharesValueByName(t *testing.T) {
+	first := NewMemMutex("test-shared")
+	second := NewMemMutex("test-shared")
+
+	first.Lock()
+	first.SetValueInt64(42)
+	first.Unlock()
+
+	second.Lock()
+	assert.Equal(t, int64(42), second.GetValueInt64())
+	assert.Equal(t, "42", second.GetValueString())
+	second.Unlock()
+
+	other := NewMemMutex("test-other")
+	assert.Equal(t, int64(0), other.GetValueInt64())
+}
+
+func TestNewMutexBackendSelection(t *testing.T) {
+	ctx := New()
+	ctx.Cfg = &config.Config{LockBackend: defaults.LockBackendMemory}
+	m, err := ctx.NewMutex("test-backend", 0, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+
+	ctx.Cfg.LockBackend = defaults.LockBackendRedis
+	_, err = ctx.NewMutex("test-backend", 0, 0)
+	assert.NotNil(t, err)
+
+	ctx.Cfg.LockBackend = "nosuchbackend"
+	_, err = ctx.NewMutex("test-backend", 0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestMemMutexTryLock(t *testing.T) {
+	first := NewMemMutex("test-trylock")
+	second := NewMemMutex("test-trylock")
+
+	assert.True(t, first.TryLock())
+	assert.False(t, second.TryLock())
+	first.Unlock()
+	assert.True(t, second.TryLock())
+	second.Unlock()
+}
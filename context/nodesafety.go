@@ -0,0 +1,45 @@
+package context
+
+import (
+	"fmt"
+	"time"
+)
+
+// Error codes of nodes the faucet refuses to sign transactions for.
+const (
+	NodeErrorUnreachable  = "node_unreachable"
+	NodeErrorWrongNetwork = "wrong_network"
+	NodeErrorCatchingUp   = "node_catching_up"
+	NodeErrorStale        = "node_stale"
+)
+
+// SafeNode returns the healthiest node, after checking that it is safe to sign a transaction for it.
+// An unsafe node is ranked last, so the next claim goes to another one.
+func (ctx *Context) SafeNode() (string, error) {
+	node := ctx.Nodes.Current()
+	err := ctx.CheckNodeHealth(ProbeNode(ctx.Nodes.client, node))
+	if err != nil {
+		ctx.Nodes.Fail(node, err)
+		return "", err
+	}
+	return node, nil
+}
+
+// CheckNodeHealth returns an error if the node is not on the testnet of the faucet, is catching up
+// or its latest block is older than MAXBLOCKAGE seconds.
+func (ctx *Context) CheckNodeHealth(health EndpointHealth) error {
+	if !health.Reachable {
+		return &Error{Code: NodeErrorUnreachable, Message: fmt.Sprintf("the network node cannot be reached: %s", health.Error), RetryAfter: 10 * time.Second}
+	}
+	if health.Network != ctx.TestnetName() {
+		return NewError(NodeErrorWrongNetwork, fmt.Sprintf("the network node is on network %s, but the faucet sends on %s", health.Network, ctx.TestnetName()))
+	}
+	if health.CatchingUp {
+		return &Error{Code: NodeErrorCatchingUp, Message: "the network node is catching up with the testnet", RetryAfter: 10 * time.Second}
+	}
+	maxBlockAge := time.Duration(ctx.Cfg.MaxBlockAge) * time.Second
+	if maxBlockAge > 0 && time.Since(health.LatestBlockTime) > maxBlockAge {
+		return &Error{Code: NodeErrorStale, Message: fmt.Sprintf("the latest block of the network node is older than %s", maxBlockAge), RetryAfter: 10 * time.Second}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCheckNodeHealth(t *testing.T) {
+	ctx := New()
+	ctx.SetTestnetName("gaia-13003")
+	ctx.Cfg.MaxBlockAge = 60
+
+	healthy := EndpointHealth{Reachable: true, Network: "gaia-13003", LatestBlockTime: time.Now()}
+	assert.Nil(t, ctx.CheckNodeHealth(healthy))
+
+	code := func(health EndpointHealth) string {
+		return ctx.CheckNodeHealth(health).(*Error).Code
+	}
+
+	unreachable := healthy
+	unreachable.Reachable = false
+	assert.Equal(t, NodeErrorUnreachable, code(unreachable))
+
+	wrongNetwork := healthy
+	wrongNetwork.Network = "gaia-13002"
+	assert.Equal(t, NodeErrorWrongNetwork, code(wrongNetwork))
+
+	catchingUp := healthy
+	catchingUp.CatchingUp = true
+	assert.Equal(t, NodeErrorCatchingUp, code(catchingUp))
+
+	stale := healthy
+	stale.LatestBlockTime = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, NodeErrorStale, code(stale))
+
+	ctx.Cfg.MaxBlockAge = 0
+	assert.Nil(t, ctx.CheckNodeHealth(stale))
+}
@@ -0,0 +1,265 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cosmos/faucet-backend/defaults"
+	"github.com/pkg/errors"
+	"github.com/throttled/throttled"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitsKey holds the rate-limit policies set with --ratelimits in the ChainKV store. They replace RATELIMITS
+// and stay in effect after a testnet reset.
+const rateLimitsKey = "ratelimits"
+
+// RateLimitPolicy allows Rate requests per Period, plus bursts of Burst requests, to every client, subnet,
+// recipient address or to all clients together, depending on the Scope.
+type RateLimitPolicy struct {
+	// Scope is what requests are counted by: ip, subnet (IPv4 /24, IPv6 /64), address (recipient of a claim) or global
+	Scope string `json:"scope"`
+
+	// Route limits the policy to the route with this path template, like /v1/claim or /v1/{chain}/claim.
+	// Every route has its own count then. Empty counts the requests of all routes together.
+	Route string `json:"route,omitempty"`
+
+	Rate   int    `json:"rate"`
+	Period string `json:"period,omitempty"`
+	Burst  int    `json:"burst"`
+}
+
+// quota returns the quota of the policy for the throttled rate limiters.
+func (p RateLimitPolicy) quota() (quota throttled.RateQuota, err error) {
+	switch p.Period {
+	case "second":
+		quota.MaxRate = throttled.PerSec(p.Rate)
+	case "", "minute":
+		quota.MaxRate = throttled.PerMin(p.Rate)
+	case "hour":
+		quota.MaxRate = throttled.PerHour(p.Rate)
+	case "day":
+		quota.MaxRate = throttled.PerDay(p.Rate)
+	default:
+		return quota, errors.New(fmt.Sprintf("unknown rate-limit period %s", p.Period))
+	}
+	quota.MaxBurst = p.Burst
+	return
+}
+
+// ParseRateLimitPolicies parses and checks a JSON list of rate-limit policies.
+func ParseRateLimitPolicies(source string) (policies []RateLimitPolicy, err error) {
+	err = json.Unmarshal([]byte(source), &policies)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid rate-limit policies: %v", err))
+	}
+	for _, policy := range policies {
+		switch policy.Scope {
+		case defaults.RateLimitIP, defaults.RateLimitSubnet, defaults.RateLimitAddress, defaults.RateLimitGlobal:
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown rate-limit scope %s", policy.Scope))
+		}
+		if policy.Rate <= 0 || policy.Burst < 0 {
+			return nil, errors.New(fmt.Sprintf("rate-limit policy %s needs a positive rate and a burst of 0 or more", policy.Scope))
+		}
+		_, err = policy.quota()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// RateLimiter checks requests against the rate-limit policies in the rate limiter store of the context.
+// The policies are read again every RATELIMITRELOAD seconds, so they can be changed without a redeploy.
+type RateLimiter struct {
+	ctx      *Context
+	lock     sync.Mutex
+	source   string
+	policies []RateLimitPolicy
+	limiters []*throttled.GCRARateLimiter
+	loadedAt time.Time
+}
+
+// NewRateLimiter creates the rate limiter of the context with its current policies.
+func (ctx *Context) NewRateLimiter() (*RateLimiter, error) {
+	l := &RateLimiter{ctx: ctx}
+	return l, l.reload()
+}
+
+// currentSource returns the policies set with --ratelimits, RATELIMITS, or one policy per client IP made of
+// LIMITERRATE and LIMITERBURST.
+func (l *RateLimiter) currentSource() (string, error) {
+	source, found, err := l.ctx.ChainKV.Get(rateLimitsKey)
+	if err != nil || found {
+		return source, err
+	}
+	if l.ctx.Cfg.RateLimits != "" {
+		return l.ctx.Cfg.RateLimits, nil
+	}
+
+	policy := RateLimitPolicy{Scope: defaults.RateLimitIP, Rate: defaults.LimiterMaxRate, Burst: defaults.LimiterMaxBurst}
+	if l.ctx.Cfg.LimiterRate > 0 {
+		policy.Rate, policy.Burst = int(l.ctx.Cfg.LimiterRate), int(l.ctx.Cfg.LimiterBurst)
+	}
+	bz, err := json.Marshal([]RateLimitPolicy{policy})
+	return string(bz), err
+}
+
+// reload reads the policies again and creates a rate limiter for each of them if they changed.
+func (l *RateLimiter) reload() error {
+	l.loadedAt = time.Now()
+	source, err := l.currentSource()
+	if err != nil || source == l.source {
+		return err
+	}
+	policies, err := ParseRateLimitPolicies(source)
+	if err != nil {
+		return err
+	}
+
+	limiters := make([]*throttled.GCRARateLimiter, 0, len(policies))
+	for _, policy := range policies {
+		quota, _ := policy.quota()
+		var limiter *throttled.GCRARateLimiter
+		limiter, err = throttled.NewGCRARateLimiter(l.ctx.Store, quota)
+		if err != nil {
+			return err
+		}
+		limiters = append(limiters, limiter)
+	}
+	if l.source != "" {
+		log.Printf("rate-limit policies changed to %s", source)
+	}
+	l.source, l.policies, l.limiters = source, policies, limiters
+	return nil
+}
+
+// current returns the policies and their rate limiters, after reading them again if they are older than RATELIMITRELOAD.
+// If they cannot be read, the previous ones stay in effect.
+func (l *RateLimiter) current() ([]RateLimitPolicy, []*throttled.GCRARateLimiter) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.ctx.Cfg.RateLimitReload > 0 && time.Since(l.loadedAt) >= time.Duration(l.ctx.Cfg.RateLimitReload)*time.Second {
+		err := l.reload()
+		if err != nil {
+			log.Printf("could not reload the rate-limit policies: %v", err)
+		}
+	}
+	return l.policies, l.limiters
+}
+
+// Policies returns the rate-limit policies in effect.
+func (l *RateLimiter) Policies() []RateLimitPolicy {
+	if l == nil {
+		return nil
+	}
+	policies, _ := l.current()
+	return policies
+}
+
+// Subnet returns the IPv4 /24 or IPv6 /64 network of an IP address.
+func Subnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if parsed.To4() != nil {
+		return (&net.IPNet{IP: parsed.To4().Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// Check counts a request to route from clientIP against the ip, subnet and global policies. If a policy is
+// over its limit, an Error with the time until the next request is allowed is returned.
+// result is the state of the most restrictive policy, for the X-RateLimit headers. It is nil if no policy applies.
+func (l *RateLimiter) Check(route string, clientIP string) (result *throttled.RateLimitResult, err error) {
+	if l == nil {
+		return nil, nil
+	}
+	return l.check(route, func(scope string) (string, bool) {
+		switch scope {
+		case defaults.RateLimitIP:
+			return clientIP, true
+		case defaults.RateLimitSubnet:
+			return Subnet(clientIP), true
+		case defaults.RateLimitGlobal:
+			return "", true
+		}
+		return "", false
+	})
+}
+
+// CheckClaim counts a claim to route for a recipient address against the address policies.
+func (l *RateLimiter) CheckClaim(route string, encodedAddress string) error {
+	if l == nil {
+		return nil
+	}
+	_, err := l.check(route, func(scope string) (string, bool) {
+		return encodedAddress, scope == defaults.RateLimitAddress
+	})
+	return err
+}
+
+// check counts a request against the policies that apply to route and to a scope that identify returns a key for.
+// It returns the result of the policy with the fewest requests remaining, or of the one over its limit.
+func (l *RateLimiter) check(route string, identify func(scope string) (string, bool)) (result *throttled.RateLimitResult, err error) {
+	policies, limiters := l.current()
+	for i, policy := range policies {
+		if policy.Route != "" && policy.Route != route {
+			continue
+		}
+		id, ok := identify(policy.Scope)
+		if !ok {
+			continue
+		}
+
+		var limited bool
+		var policyResult throttled.RateLimitResult
+		limited, policyResult, err = limiters[i].RateLimit(policyKey(policy, id), 1)
+		if err != nil {
+			return nil, err
+		}
+		if limited {
+			return &policyResult, &Error{
+				Code:       "rate_limited",
+				Message:    fmt.Sprintf("too many requests (%s limit of %d per %s), try again in %s", policy.Scope, policy.Rate, policyPeriod(policy), policyResult.RetryAfter.Round(time.Second)),
+				RetryAfter: policyResult.RetryAfter,
+			}
+		}
+		if result == nil || policyResult.Remaining < result.Remaining {
+			result = &policyResult
+		}
+	}
+	return result, nil
+}
+
+// policyKey is the key of the counts of a policy for a client, recipient address or subnet. It is made of the policy
+// itself, so the counts survive a reload that reorders the policies and start over when a policy changes.
+func policyKey(policy RateLimitPolicy, id string) string {
+	return fmt.Sprintf("ratelimit|%s|%s|%d|%s|%d|%s", policy.Scope, policy.Route, policy.Rate, policyPeriod(policy), policy.Burst, id)
+}
+
+// policyPeriod returns the period of a policy, minute if it is not set.
+func policyPeriod(policy RateLimitPolicy) string {
+	if policy.Period == "" {
+		return "minute"
+	}
+	return policy.Period
+}
+
+// SetRateLimitPolicies stores rate-limit policies in the key-value store. They replace RATELIMITS in every faucet
+// process that shares the store within RATELIMITRELOAD seconds. Empty policies go back to RATELIMITS.
+func (ctx *Context) SetRateLimitPolicies(source string) error {
+	if strings.TrimSpace(source) == "" {
+		return ctx.ChainKV.Delete(rateLimitsKey)
+	}
+	_, err := ParseRateLimitPolicies(source)
+	if err != nil {
+		return err
+	}
+	return ctx.ChainKV.Set(rateLimitsKey, source, 0)
+}
@@ -0,0 +1,136 @@
+package context
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/throttled/throttled/store/memstore"
+	"testing"
+	"time"
+)
+
+func newRateLimitContext(t *testing.T, policies string) *Context {
+	ctx := New()
+	var err error
+	ctx.Store, err = memstore.New(65536)
+	assert.Nil(t, err)
+	ctx.Cfg.RateLimits = policies
+	ctx.RateLimiter, err = ctx.NewRateLimiter()
+	assert.Nil(t, err)
+	return ctx
+}
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	policies, err := ParseRateLimitPolicies(`[{"scope":"ip","rate":10},{"scope":"address","route":"/v1/claim","rate":2,"period":"day","burst":1}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, []RateLimitPolicy{
+		{Scope: "ip", Rate: 10},
+		{Scope: "address", Route: "/v1/claim", Rate: 2, Period: "day", Burst: 1},
+	}, policies)
+
+	for _, invalid := range []string{
+		`{"scope":"ip","rate":10}`,
+		`[{"scope":"country","rate":10}]`,
+		`[{"scope":"ip","rate":0}]`,
+		`[{"scope":"ip","rate":10,"burst":-1}]`,
+		`[{"scope":"ip","rate":10,"period":"week"}]`,
+	} {
+		_, err = ParseRateLimitPolicies(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	assert.Equal(t, "1.2.3.0/24", Subnet("1.2.3.4"))
+	assert.Equal(t, "2001:db8:1:2::/64", Subnet("2001:db8:1:2:3:4:5:6"))
+	assert.Equal(t, "not-an-ip", Subnet("not-an-ip"))
+}
+
+func TestRateLimiterCheck(t *testing.T) {
+	ctx := newRateLimitContext(t, `[{"scope":"ip","route":"/v1/claim","rate":1},{"scope":"subnet","rate":2,"burst":1}]`)
+
+	result, err := ctx.RateLimiter.Check("/v1/claim", "1.2.3.4")
+	assert.Nil(t, err)
+	if assert.NotNil(t, result) {
+		// The ip policy has no request left
+		assert.Equal(t, 1, result.Limit)
+		assert.Equal(t, 0, result.Remaining)
+	}
+	_, err = ctx.RateLimiter.Check("/v1/claim", "1.2.3.4")
+	assert.NotNil(t, err)
+	assert.Equal(t, "rate_limited", err.(*Error).Code)
+	assert.True(t, err.(*Error).RetryAfter > 0)
+
+	// The ip policy only counts its route, the subnet policy counts all of them
+	_, err = ctx.RateLimiter.Check("/", "1.2.3.4")
+	assert.Nil(t, err)
+	_, err = ctx.RateLimiter.Check("/", "1.2.3.5")
+	assert.NotNil(t, err)
+	_, err = ctx.RateLimiter.Check("/", "1.2.4.4")
+	assert.Nil(t, err)
+
+	// Without policies for them, recipient addresses are not limited
+	assert.Nil(t, ctx.RateLimiter.CheckClaim("/v1/claim", "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql"))
+	assert.Nil(t, ctx.RateLimiter.CheckClaim("/v1/claim", "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql"))
+}
+
+func TestRateLimiterReload(t *testing.T) {
+	ctx := newRateLimitContext(t, "")
+	ctx.Cfg.RateLimitReload = 60
+	assert.Equal(t, []RateLimitPolicy{{Scope: "ip", Rate: 10}}, ctx.RateLimiter.Policies())
+
+	err := ctx.SetRateLimitPolicies(`[{"scope":"address","rate":1,"period":"day"}]`)
+	assert.Nil(t, err)
+	assert.NotNil(t, ctx.SetRateLimitPolicies(`[{"scope":"nobody","rate":1}]`))
+
+	// The policies are read again once they are older than RATELIMITRELOAD
+	assert.Equal(t, []RateLimitPolicy{{Scope: "ip", Rate: 10}}, ctx.RateLimiter.Policies())
+	ctx.RateLimiter.loadedAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, []RateLimitPolicy{{Scope: "address", Rate: 1, Period: "day"}}, ctx.RateLimiter.Policies())
+
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql"
+	assert.Nil(t, ctx.RateLimiter.CheckClaim("/v1/claim", address))
+	assert.NotNil(t, ctx.RateLimiter.CheckClaim("/v1/claim", address))
+	result, err := ctx.RateLimiter.Check("/v1/claim", "1.2.3.4")
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	// An empty policy goes back to RATELIMITS
+	assert.Nil(t, ctx.SetRateLimitPolicies(""))
+	ctx.RateLimiter.loadedAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, []RateLimitPolicy{{Scope: "ip", Rate: 10}}, ctx.RateLimiter.Policies())
+}
+
+func TestRateLimiterReloadKeepsCounts(t *testing.T) {
+	ctx := newRateLimitContext(t, `[{"scope":"ip","rate":1},{"scope":"subnet","rate":5,"burst":10}]`)
+	ctx.Cfg.RateLimitReload = 60
+	_, err := ctx.RateLimiter.Check("/", "1.2.3.4")
+	assert.Nil(t, err)
+
+	// Reordered policies keep their counts
+	assert.Nil(t, ctx.SetRateLimitPolicies(`[{"scope":"subnet","rate":5,"burst":10},{"scope":"ip","rate":1}]`))
+	ctx.RateLimiter.loadedAt = time.Now().Add(-time.Minute)
+	_, err = ctx.RateLimiter.Check("/", "1.2.3.4")
+	assert.NotNil(t, err)
+
+	// A changed policy starts counting from zero
+	assert.Nil(t, ctx.SetRateLimitPolicies(`[{"scope":"subnet","rate":5,"burst":10},{"scope":"ip","rate":2}]`))
+	ctx.RateLimiter.loadedAt = time.Now().Add(-time.Minute)
+	_, err = ctx.RateLimiter.Check("/", "1.2.3.4")
+	assert.Nil(t, err)
+}
+
+func TestRateLimitPoliciesSurviveTestnetReset(t *testing.T) {
+	node := newStatusServer("gaia-13004", false, time.Now())
+	defer node.Close()
+
+	ctx := newRateLimitContext(t, "")
+	ctx.Cfg.RateLimitReload = 60
+	ctx.Nodes = NewEndpointPool("node", []string{node.URL}, ProbeNode)
+	ctx.SetTestnetName("gaia-13003")
+	assert.Nil(t, ctx.SetRateLimitPolicies(`[{"scope":"address","rate":1,"period":"day"}]`))
+
+	// The reset replaces the key-value store of the testnet, not the one of the chain
+	assert.Nil(t, ctx.resetTestnet())
+	assert.Equal(t, "gaia-13004", ctx.TestnetName())
+	ctx.RateLimiter.loadedAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, []RateLimitPolicy{{Scope: "address", Rate: 1, Period: "day"}}, ctx.RateLimiter.Policies())
+}
@@ -0,0 +1,188 @@
+package context
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ResetEvent is a testnet reset noticed by WatchTestnet.
+type ResetEvent struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// ResetStats counts the testnet resets of a context.
+type ResetStats struct {
+	Resets    int64       `json:"resets"`
+	Failures  int64       `json:"failures"`
+	LastReset *ResetEvent `json:"last_reset,omitempty"`
+}
+
+// resetMetrics holds the ResetStats of a context.
+type resetMetrics struct {
+	lock  sync.Mutex
+	stats ResetStats
+}
+
+// DetectReset compares the health of the nodes with the heights they reported before.
+// The testnet was reset if all nodes that answered are on a new network (unless CHAINID pins it),
+// or all of them report a lower height than before.
+func (ctx *Context) DetectReset(nodes []EndpointHealth, lastHeights map[string]int64) (reason string, reset bool) {
+	newNetwork := ""
+	answered, moved, regressed := 0, 0, 0
+	for _, node := range nodes {
+		if node.Network == "" {
+			continue
+		}
+		answered++
+		if node.Network != ctx.TestnetName() {
+			if newNetwork == "" || newNetwork == node.Network {
+				newNetwork = node.Network
+				moved++
+			}
+			continue
+		}
+		if last, ok := lastHeights[node.URL]; ok && node.LatestHeight < last {
+			regressed++
+		}
+	}
+	if answered == 0 {
+		return "", false
+	}
+
+	if ctx.Cfg.ChainID == "" && moved == answered {
+		return fmt.Sprintf("chain-id changed from %s to %s", ctx.TestnetName(), newNetwork), true
+	}
+	if regressed == answered {
+		return fmt.Sprintf("block height of %s went backwards", ctx.TestnetName()), true
+	}
+	return "", false
+}
+
+// WatchTestnet looks for testnet resets every interval until stop is closed, and re-initializes the context
+// when it finds one.
+func (ctx *Context) WatchTestnet(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastHeights := make(map[string]int64)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		nodes := ctx.Nodes.Status()
+		reason, reset := ctx.DetectReset(nodes, lastHeights)
+		if reset {
+			ctx.ResetTestnet(reason)
+			lastHeights = make(map[string]int64)
+			continue
+		}
+		for _, node := range nodes {
+			if node.Network == ctx.TestnetName() && node.Reachable {
+				lastHeights[node.URL] = node.LatestHeight
+			}
+		}
+	}
+}
+
+// ResetTestnet re-initializes the context for a new testnet: it reads the testnet name again, moves the
+// mutexes and the key-value store to the new lock namespace and reads the account number and sequence of
+// every account. It waits until no transaction of the faucet accounts is in flight.
+func (ctx *Context) ResetTestnet(reason string) {
+	event := ResetEvent{
+		Time:   time.Now(),
+		Reason: reason,
+		From:   ctx.TestnetName(),
+	}
+	log.Printf("testnet reset detected: %s", reason)
+
+	// The reset replaces the busy mutexes, the ones of the old testnet are released afterwards
+	accounts := ctx.Accounts
+	if ctx.Treasury != nil {
+		accounts = append(accounts[:len(accounts):len(accounts)], ctx.Treasury)
+	}
+	busy := make([]Mutex, 0, len(accounts))
+	for _, acc := range accounts {
+		m := acc.busyMutex()
+		for !m.TryLock() {
+			time.Sleep(100 * time.Millisecond)
+		}
+		busy = append(busy, m)
+	}
+	defer func() {
+		for _, m := range busy {
+			m.Unlock()
+		}
+	}()
+
+	err := ctx.resetTestnet()
+	event.To = ctx.TestnetName()
+	if err != nil {
+		event.Error = err.Error()
+		log.Printf("could not re-initialize after the testnet reset: %v", err)
+	} else {
+		log.Printf("re-initialized for testnet %s (was %s)", event.To, event.From)
+	}
+
+	ctx.resets.lock.Lock()
+	defer ctx.resets.lock.Unlock()
+	if err != nil {
+		ctx.resets.stats.Failures++
+	} else {
+		ctx.resets.stats.Resets++
+	}
+	ctx.resets.stats.LastReset = &event
+}
+
+// resetTestnet runs the parts of the initialization that depend on the testnet. The caller holds all accounts
+// and the treasury. The name, the key-value store and the TxContext of the new testnet are swapped in at once.
+func (ctx *Context) resetTestnet() (err error) {
+	name, err := ctx.readTestnetName()
+	if err != nil {
+		return
+	}
+	testnet := ctx.Testnet()
+	testnet.Name = name
+	testnet.KV = ctx.NewKVStore(ctx.lockPrefix(name))
+	if testnet.TxContext != nil {
+		txCtx := testnet.TxContext.WithChainID(name)
+		testnet.TxContext = &txCtx
+	}
+	ctx.Nodes.SetNetwork(name)
+	ctx.SetTestnet(testnet)
+
+	err = ctx.SetupAccountMutexes()
+	if err != nil {
+		return
+	}
+	if ctx.Treasury != nil {
+		err = ctx.setupMutexes(ctx.Treasury)
+		if err != nil {
+			return
+		}
+	}
+
+	// The mutexes of the new namespace have no broken flag yet, so the account details are read again.
+	// An account that does not exist yet on the new testnet is fixed by its next claim.
+	for _, acc := range ctx.Accounts {
+		accErr := ctx.CheckAndFixAccountDetails(acc)
+		if accErr != nil {
+			log.Printf("could not read account %s after the testnet reset: %v", acc.Address.String(), accErr)
+		}
+	}
+	return
+}
+
+// ResetStats returns the number of testnet resets and the last one.
+func (ctx *Context) ResetStats() ResetStats {
+	ctx.resets.lock.Lock()
+	defer ctx.resets.lock.Unlock()
+	return ctx.resets.stats
+}
@@ -0,0 +1,122 @@
+package context
+
+import (
+	"github.com/cosmos/cosmos-sdk/cmd/gaia/app"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unknownAccountReader knows no account, like the node of a testnet that was just reset.
+type unknownAccountReader struct{}
+
+func (unknownAccountReader) ReadAccount(address sdk.AccAddress) (auth.Account, error) {
+	return nil, &UnknownAccountError{Address: address.String()}
+}
+func TestDetectReset(t *testing.T) {
+	ctx := New()
+	ctx.SetTestnetName("gaia-13003")
+	lastHeights := map[string]int64{"http://a": 100, "http://b": 101}
+
+	_, reset := ctx.DetectReset([]EndpointHealth{
+		{URL: "http://a", Network: "gaia-13003", LatestHeight: 102},
+		{URL: "http://b", Network: "gaia-13003", LatestHeight: 3},
+		{URL: "http://c"},
+	}, lastHeights)
+	assert.False(t, reset)
+
+	reason, reset := ctx.DetectReset([]EndpointHealth{
+		{URL: "http://a", Network: "gaia-13003", LatestHeight: 2},
+		{URL: "http://b", Network: "gaia-13003", LatestHeight: 3},
+	}, lastHeights)
+	assert.True(t, reset)
+	assert.Contains(t, reason, "height")
+
+	newNetwork := []EndpointHealth{
+		{URL: "http://a", Network: "gaia-13004", LatestHeight: 2},
+		{URL: "http://b", Network: "gaia-13004", LatestHeight: 3},
+	}
+	reason, reset = ctx.DetectReset(newNetwork, lastHeights)
+	assert.True(t, reset)
+	assert.Equal(t, "chain-id changed from gaia-13003 to gaia-13004", reason)
+
+	// A pinned chain-id makes nodes on other networks wrong, not a reset
+	ctx.Cfg.ChainID = "gaia-13003"
+	_, reset = ctx.DetectReset(newNetwork, lastHeights)
+	assert.False(t, reset)
+
+	ctx.Cfg.ChainID = ""
+	_, reset = ctx.DetectReset([]EndpointHealth{
+		{URL: "http://a", Network: "gaia-13004"},
+		{URL: "http://b", Network: "gaia-13005"},
+	}, lastHeights)
+	assert.False(t, reset)
+}
+
+func TestResetTestnetDuringClaims(t *testing.T) {
+	node := newStatusServer("gaia-13004", false, time.Now())
+	defer node.Close()
+
+	ctx := New()
+	ctx.Cdc = app.MakeCodec()
+	ctx.Cfg.Timeout = 1
+	ctx.Cfg.ClaimCooldown = 60
+	ctx.Cfg.MaxBalance = "1000steak"
+	ctx.AccountReader = unknownAccountReader{}
+	ctx.Nodes = NewEndpointPool("node", []string{node.URL}, ProbeNode)
+	ctx.SetTestnetName("gaia-13003")
+	amount := sdk.Coins{sdk.NewInt64Coin("steak", 10)}
+	for i := 0; i < 3; i++ {
+		acc := newTestAccount(t, ctx)
+		acc.SetBalance(sdk.Coins{sdk.NewInt64Coin("steak", 100)})
+		ctx.Accounts = append(ctx.Accounts, acc)
+	}
+	claimed := sdk.AccAddress(secp256k1.GenPrivKey().PubKey().Address()).String()
+	assert.Nil(t, ctx.ReserveClaim(claimed))
+
+	// Claims keep going while the testnet is reset
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				address := sdk.AccAddress(secp256k1.GenPrivKey().PubKey().Address()).String()
+				assert.Nil(t, ctx.ReserveClaim(address))
+				assert.Nil(t, ctx.CheckEligibility(address))
+				acc, err := ctx.AcquireAccount(amount)
+				if err == nil {
+					acc.SequenceMutex.Lock()
+					acc.SequenceMutex.SetValueInt64(acc.SequenceMutex.GetValueInt64() + 1)
+					acc.SequenceMutex.Unlock()
+					ctx.ReleaseAccount(acc)
+				}
+				testnet := ctx.Testnet()
+				assert.Contains(t, []string{"gaia-13003", "gaia-13004"}, testnet.Name)
+				assert.NotNil(t, testnet.KV)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	ctx.ResetTestnet("chain-id changed from gaia-13003 to gaia-13004")
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	assert.Equal(t, "gaia-13004", ctx.TestnetName())
+	assert.Equal(t, int64(1), ctx.ResetStats().Resets)
+	// The cooldowns of the old testnet are gone
+	assert.Nil(t, ctx.ReserveClaim(claimed))
+	assert.NotNil(t, ctx.ReserveClaim(claimed))
+}
@@ -0,0 +1,210 @@
+package context
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cosmos/cosmos-sdk/client/keys"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/pkg/errors"
+	tmbcrypt "github.com/tendermint/crypto/bcrypt"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/armor"
+	"github.com/tendermint/tendermint/crypto/encoding/amino"
+	"github.com/tendermint/tendermint/crypto/xsalsa20symmetric"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// armoredKeyBlockType is the armor type of the private keys exported by gaiacli.
+const armoredKeyBlockType = "TENDERMINT PRIVATE KEY"
+
+// bcryptSecurityParameter is the bcrypt cost used by gaiacli to encrypt exported private keys.
+const bcryptSecurityParameter = 12
+
+// Signer signs transactions for a faucet account. The private key does not need to be available to the faucet.
+type Signer interface {
+	// PubKey returns the public key of the account.
+	PubKey() crypto.PubKey
+	// Address returns the address of the account.
+	Address() sdk.AccAddress
+	// Sign returns the signature of the sign bytes of a transaction.
+	Sign(msg []byte) ([]byte, error)
+}
+
+// keySigner is a Signer that holds the private key in memory.
+type keySigner struct {
+	privKey crypto.PrivKey
+}
+
+// NewKeySigner creates a Signer from a private key.
+func NewKeySigner(privKey crypto.PrivKey) Signer {
+	return &keySigner{privKey: privKey}
+}
+
+func (s *keySigner) PubKey() crypto.PubKey {
+	return s.privKey.PubKey()
+}
+
+func (s *keySigner) Address() sdk.AccAddress {
+	return sdk.AccAddress(s.privKey.PubKey().Address())
+}
+
+func (s *keySigner) Sign(msg []byte) ([]byte, error) {
+	return s.privKey.Sign(msg)
+}
+
+// NewKeyFileSigner creates a Signer from a passphrase-encrypted armored private key file,
+// as exported by gaiacli.
+func NewKeyFileSigner(keyFile string, passphrase string) (Signer, error) {
+	armorBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := UnarmorDecryptPrivKey(string(armorBytes), passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not decrypt key file %s", keyFile))
+	}
+	return NewKeySigner(privKey), nil
+}
+
+// UnarmorDecryptPrivKey decrypts an armored private key with its passphrase.
+func UnarmorDecryptPrivKey(armorString string, passphrase string) (crypto.PrivKey, error) {
+	blockType, header, encryptedBytes, err := armor.DecodeArmor(armorString)
+	if err != nil {
+		return nil, err
+	}
+	if blockType != armoredKeyBlockType {
+		return nil, errors.New(fmt.Sprintf("unrecognized armor type %s", blockType))
+	}
+	if header["kdf"] != "bcrypt" {
+		return nil, errors.New(fmt.Sprintf("unrecognized key derivation function %s", header["kdf"]))
+	}
+	salt, err := hex.DecodeString(header["salt"])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := tmbcrypt.GenerateFromPassword(salt, []byte(passphrase), bcryptSecurityParameter)
+	if err != nil {
+		return nil, err
+	}
+	privKeyBytes, err := xsalsa20symmetric.DecryptSymmetric(encryptedBytes, crypto.Sha256(key))
+	if err != nil {
+		return nil, errors.New("invalid passphrase")
+	}
+	return cryptoAmino.PrivKeyFromBytes(privKeyBytes)
+}
+
+// NewKeyringSigner creates a Signer from a key stored in a gaiacli keyring directory (usually ~/.gaiacli).
+func NewKeyringSigner(keyringDir string, name string, passphrase string) (Signer, error) {
+	keybase, err := keys.GetKeyBaseFromDir(keyringDir)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := keybase.ExportPrivateKeyObject(name, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not read key %s from %s", name, keyringDir))
+	}
+	return NewKeySigner(privKey), nil
+}
+
+// remoteSigner is a Signer that asks a signing service over HTTP for signatures.
+//
+// The service answers GET {url}/pubkey with {"pub_key":"<base64 amino encoded public key>"}
+// and POST {url}/sign with body {"sign_bytes":"<base64>"} with {"signature":"<base64>"}.
+type remoteSigner struct {
+	url    string
+	token  string
+	pubKey crypto.PubKey
+	client *http.Client
+}
+
+// remoteSignRequest is the body of a sign request to a remote signer.
+type remoteSignRequest struct {
+	SignBytes []byte `json:"sign_bytes"`
+}
+
+// remoteSignResponse is the answer of a remote signer to a sign request.
+type remoteSignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// remotePubKeyResponse is the answer of a remote signer to a public key request.
+type remotePubKeyResponse struct {
+	PubKey []byte `json:"pub_key"`
+}
+
+// NewRemoteSigner creates a Signer for a remote signing service. The public key is read from the service.
+// If token is set, it is sent as a bearer token.
+func NewRemoteSigner(url string, token string) (Signer, error) {
+	s := &remoteSigner{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var response remotePubKeyResponse
+	err := s.call("GET", "/pubkey", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	s.pubKey, err = cryptoAmino.PubKeyFromBytes(response.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *remoteSigner) PubKey() crypto.PubKey {
+	return s.pubKey
+}
+
+func (s *remoteSigner) Address() sdk.AccAddress {
+	return sdk.AccAddress(s.pubKey.Address())
+}
+
+func (s *remoteSigner) Sign(msg []byte) ([]byte, error) {
+	var response remoteSignResponse
+	err := s.call("POST", "/sign", remoteSignRequest{SignBytes: msg}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pubKey.VerifyBytes(msg, response.Signature) {
+		return nil, errors.New("remote signer returned an invalid signature")
+	}
+	return response.Signature, nil
+}
+
+// call sends a request to the remote signer and decodes the JSON answer into response.
+func (s *remoteSigner) call(method string, path string, request interface{}, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("http error code %d calling remote signer", resp.StatusCode))
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,88 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	tmbcrypt "github.com/tendermint/crypto/bcrypt"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/armor"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tendermint/tendermint/crypto/xsalsa20symmetric"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// armorEncryptPrivKey encrypts a private key the same way gaiacli exports it.
+func armorEncryptPrivKey(privKey crypto.PrivKey, passphrase string) string {
+	salt := crypto.CRandBytes(16)
+	key, err := tmbcrypt.GenerateFromPassword(salt, []byte(passphrase), bcryptSecurityParameter)
+	if err != nil {
+		panic(err)
+	}
+	encryptedBytes := xsalsa20symmetric.EncryptSymmetric(privKey.Bytes(), crypto.Sha256(key))
+	header := map[string]string{
+		"kdf":  "bcrypt",
+		"salt": fmt.Sprintf("%X", salt),
+	}
+	return armor.EncodeArmor(armoredKeyBlockType, header, encryptedBytes)
+}
+
+func TestKeyFileSigner(t *testing.T) {
+	privKey := secp256k1.GenPrivKey()
+
+	keyFile, err := ioutil.TempFile("", "f11-key")
+	assert.Nil(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.WriteString(armorEncryptPrivKey(privKey, "passphrase"))
+	assert.Nil(t, err)
+	keyFile.Close()
+
+	_, err = NewKeyFileSigner(keyFile.Name(), "wrong")
+	assert.NotNil(t, err)
+
+	signer, err := NewKeyFileSigner(keyFile.Name(), "passphrase")
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.PubKey(), signer.PubKey())
+	assert.Equal(t, []byte(privKey.PubKey().Address()), []byte(signer.Address()))
+
+	sig, err := signer.Sign([]byte("message"))
+	assert.Nil(t, err)
+	assert.True(t, privKey.PubKey().VerifyBytes([]byte("message"), sig))
+}
+
+func TestRemoteSigner(t *testing.T) {
+	privKey := secp256k1.GenPrivKey()
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/pubkey":
+			json.NewEncoder(w).Encode(remotePubKeyResponse{PubKey: privKey.PubKey().Bytes()})
+		case "/sign":
+			var request remoteSignRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			sig, _ := privKey.Sign(request.SignBytes)
+			json.NewEncoder(w).Encode(remoteSignResponse{Signature: sig})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer stub.Close()
+
+	_, err := NewRemoteSigner(stub.URL, "wrong")
+	assert.NotNil(t, err)
+
+	signer, err := NewRemoteSigner(stub.URL, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.PubKey(), signer.PubKey())
+
+	sig, err := signer.Sign([]byte("message"))
+	assert.Nil(t, err)
+	assert.True(t, privKey.PubKey().VerifyBytes([]byte("message"), sig))
+}
@@ -0,0 +1,218 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+// treasuryAuditKey is the list of refill audit entries in the key-value store.
+const treasuryAuditKey = "treasury:audit"
+
+// treasuryAuditMaxEntries is the number of refill audit entries kept.
+const treasuryAuditMaxEntries = 1000
+
+// RefillFunc sends amount from the treasury to a faucet account.
+type RefillFunc func(acc *Account, amount sdk.Coins) (height int64, hash string, err error)
+
+// RefillEntry is an audit record of a treasury refill.
+type RefillEntry struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Amount string    `json:"amount"`
+	Hash   string    `json:"hash,omitempty"`
+	Height int64     `json:"height,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// treasurySigner creates the Signer of the treasury from TREASURYKEY, TREASURYKEYFILE, the TREASURYKEYNAME key of
+// TREASURYKEYRING or TREASURYSIGNER. signer is nil if no treasury is configured.
+func (ctx *Context) treasurySigner() (signer Signer, err error) {
+	cfg := ctx.Cfg
+	configured := 0
+	for _, setting := range []string{cfg.TreasuryKey, cfg.TreasuryKeyFile, cfg.TreasuryKeyring, cfg.TreasurySigner} {
+		if setting != "" {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, errors.New("set only one of TREASURYKEY, TREASURYKEYFILE, TREASURYKEYRING and TREASURYSIGNER")
+	}
+
+	switch {
+	case cfg.TreasuryKey != "":
+		privKey, err := privKeyFromString(cfg.TreasuryKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySigner(privKey), nil
+	case cfg.TreasuryKeyFile != "":
+		return NewKeyFileSigner(cfg.TreasuryKeyFile, cfg.TreasuryKeyPass)
+	case cfg.TreasuryKeyring != "":
+		return NewKeyringSigner(cfg.TreasuryKeyring, cfg.TreasuryKeyName, cfg.TreasuryKeyPass)
+	case cfg.TreasurySigner != "":
+		return NewRemoteSigner(cfg.TreasurySigner, cfg.TreasuryToken)
+	}
+	return nil, nil
+}
+
+// LoadTreasury creates the treasury account, see treasurySigner. It has its own mutexes, apart from the faucet accounts.
+func (ctx *Context) LoadTreasury() (err error) {
+	ctx.Treasury = nil
+	signer, err := ctx.treasurySigner()
+	if err != nil || signer == nil {
+		return
+	}
+	if ctx.Cfg.RefillAmount == "" || ctx.Cfg.RefillDailyCap == "" {
+		return errors.New("the treasury needs REFILLAMOUNT and REFILLDAILYCAP")
+	}
+
+	treasury := newAccount(signer)
+	treasury.lockName = fmt.Sprintf("treasury-%s", treasury.lockName)
+	err = ctx.setupMutexes(treasury)
+	if err != nil {
+		return
+	}
+
+	ctx.Treasury = treasury
+	log.Printf("treasury %s refills the faucet accounts", treasury.Address.String())
+	return
+}
+
+// RefillThreshold returns the balance under which a faucet account is refilled: REFILLTHRESHOLD, or the low-water mark.
+func (ctx *Context) RefillThreshold() (sdk.Coins, error) {
+	if ctx.Cfg.RefillThreshold != "" {
+		return sdk.ParseCoins(ctx.Cfg.RefillThreshold)
+	}
+	return ctx.LowWaterMark()
+}
+
+// RefillAmount returns the part of REFILLAMOUNT that tops up the denominations the account is low on.
+func (ctx *Context) RefillAmount(balance sdk.Coins) (sdk.Coins, error) {
+	threshold, err := ctx.RefillThreshold()
+	if err != nil {
+		return nil, err
+	}
+	refill, err := sdk.ParseCoins(ctx.Cfg.RefillAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	low := make(map[string]bool)
+	for _, denom := range LowDenoms(balance, threshold) {
+		low[denom] = true
+	}
+	amount := sdk.Coins{}
+	for _, coin := range refill {
+		if low[coin.Denom] {
+			amount = append(amount, coin)
+		}
+	}
+	return amount, nil
+}
+
+// reserveRefill counts amount against the REFILLDAILYCAP of the current UTC day. It returns false, and counts
+// nothing, if the refill would go over the cap in any denomination.
+func (ctx *Context) reserveRefill(amount sdk.Coins) (ok bool, err error) {
+	dailyCap, err := sdk.ParseCoins(ctx.Cfg.RefillDailyCap)
+	if err != nil {
+		return
+	}
+
+	day := time.Now().UTC().Format("2006-01-02")
+	var reserved []sdk.Coin
+	defer func() {
+		if ok {
+			return
+		}
+		for _, coin := range reserved {
+			ctx.KV().IncrementByDecimal(fmt.Sprintf("treasury:refilled:%s:%s", day, coin.Denom), coin.Amount.Neg().String(), 0)
+		}
+	}()
+	for _, coin := range amount {
+		var value string
+		value, err = ctx.KV().IncrementByDecimal(fmt.Sprintf("treasury:refilled:%s:%s", day, coin.Denom), coin.Amount.String(), 48*time.Hour)
+		if err != nil {
+			return
+		}
+		reserved = append(reserved, coin)
+		total, valid := sdk.NewIntFromString(value)
+		if !valid {
+			return false, errors.New(fmt.Sprintf("invalid refill counter %s", value))
+		}
+		if total.GT(dailyCap.AmountOf(coin.Denom)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// refillAccount sends the refill amount to an account that is low. The refill lock keeps other processes from
+// refilling the same account until the refill shows in its balance.
+func (ctx *Context) refillAccount(acc *Account, refill RefillFunc, interval time.Duration) (err error) {
+	balance, known := acc.Balance()
+	if !known {
+		return
+	}
+	amount, err := ctx.RefillAmount(balance)
+	if err != nil || len(amount) == 0 {
+		return
+	}
+
+	// A testnet reset waits for the refill, the treasury is refilling another account if it is busy
+	if !ctx.Treasury.tryAcquire() {
+		return
+	}
+	defer ctx.Treasury.release()
+
+	ok, err := ctx.KV().SetIfNotExists(fmt.Sprintf("treasury:lock:%s", acc.Address.String()), ctx.Treasury.Address.String(), interval)
+	if err != nil || !ok {
+		return
+	}
+
+	ok, err = ctx.reserveRefill(amount)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return errors.New(fmt.Sprintf("refill of %s would exceed the daily cap of %s", amount.String(), ctx.Cfg.RefillDailyCap))
+	}
+
+	entry := RefillEntry{
+		Time:   time.Now(),
+		From:   ctx.Treasury.Address.String(),
+		To:     acc.Address.String(),
+		Amount: amount.String(),
+	}
+	// A failed refill still counts against the daily cap: after a timeout it might have landed anyway
+	entry.Height, entry.Hash, err = refill(acc, amount)
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		log.Printf("refilled %s with %s from the treasury in transaction %s", entry.To, entry.Amount, entry.Hash)
+		// Claims spent from the account while the refill was sent, so its balance is read from the testnet
+		refreshErr := ctx.RefreshAccountBalance(acc)
+		if refreshErr != nil {
+			log.Printf("could not refresh balance of %s after the refill: %v", entry.To, refreshErr)
+		}
+	}
+
+	auditErr := ctx.auditRefill(entry)
+	if auditErr != nil {
+		log.Printf("could not record refill of %s: %v", entry.To, auditErr)
+	}
+	return
+}
+
+// auditRefill adds a refill to the audit list.
+func (ctx *Context) auditRefill(entry RefillEntry) error {
+	bz, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ctx.KV().Push(treasuryAuditKey, string(bz), treasuryAuditMaxEntries, 0)
+}
@@ -0,0 +1,123 @@
+package context
+
+import (
+	"encoding/base64"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"testing"
+	"time"
+)
+
+func TestRefillAmount(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.RefillThreshold = "100photino,100steak"
+	ctx.Cfg.RefillAmount = "1000photino,1000steak"
+
+	amount, err := ctx.RefillAmount(sdk.Coins{sdk.NewInt64Coin("photino", 500), sdk.NewInt64Coin("steak", 50)})
+	assert.Nil(t, err)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 1000)}, amount)
+
+	amount, err = ctx.RefillAmount(sdk.Coins{sdk.NewInt64Coin("photino", 500), sdk.NewInt64Coin("steak", 500)})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(amount))
+}
+
+func TestReserveRefill(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.RefillDailyCap = "2500steak,1000photino"
+
+	refill := sdk.Coins{sdk.NewInt64Coin("steak", 1000)}
+	for i := 0; i < 2; i++ {
+		ok, err := ctx.reserveRefill(refill)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := ctx.reserveRefill(refill)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// A refused refill is not counted
+	ok, err = ctx.reserveRefill(sdk.Coins{sdk.NewInt64Coin("steak", 500)})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Denominations without a cap are never refilled
+	ok, err = ctx.reserveRefill(sdk.Coins{sdk.NewInt64Coin("atom", 1)})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestReserveRefillBeyondInt64(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.RefillDailyCap = "25000000000000000000steak"
+
+	refill, err := sdk.ParseCoins("10000000000000000000steak")
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		ok, err := ctx.reserveRefill(refill)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := ctx.reserveRefill(refill)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestTreasurySigner(t *testing.T) {
+	ctx := New()
+	signer, err := ctx.treasurySigner()
+	assert.Nil(t, err)
+	assert.Nil(t, signer)
+
+	privKey := secp256k1.GenPrivKey()
+	ctx.Cfg.TreasuryKey = base64.StdEncoding.EncodeToString(privKey.Bytes())
+	signer, err = ctx.treasurySigner()
+	if assert.Nil(t, err) {
+		assert.Equal(t, []byte(privKey.PubKey().Address()), []byte(signer.Address()))
+	}
+
+	// The treasury has a single key
+	ctx.Cfg.TreasurySigner = "http://127.0.0.1:1"
+	_, err = ctx.treasurySigner()
+	assert.NotNil(t, err)
+}
+
+func TestCheckBalanceRefillsFromTreasury(t *testing.T) {
+	ctx := New()
+	ctx.Cfg.LowBalance = "100steak"
+	ctx.Cfg.RefillAmount = "1000steak"
+	ctx.Cfg.RefillDailyCap = "5000steak"
+	low := newTestAccount(t, ctx)
+	full := newTestAccount(t, ctx)
+	ctx.Accounts = []*Account{low, full}
+	ctx.Treasury = newTestAccount(t, ctx)
+	reader := &stubAccountReader{balances: map[string]sdk.Coins{
+		string(low.Address.Bytes()):  {sdk.NewInt64Coin("steak", 10)},
+		string(full.Address.Bytes()): {sdk.NewInt64Coin("steak", 500)},
+	}}
+	ctx.AccountReader = reader
+
+	var refilled []sdk.AccAddress
+	refill := func(acc *Account, amount sdk.Coins) (int64, string, error) {
+		assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 1000)}, amount)
+		refilled = append(refilled, acc.Address)
+		// A claim was paid while the refill was sent
+		reader.balances[string(acc.Address.Bytes())] = sdk.Coins{sdk.NewInt64Coin("steak", 1005)}
+		return 1, "HASH", nil
+	}
+	lowWater, err := ctx.LowWaterMark()
+	assert.Nil(t, err)
+
+	// The balance check refills the low account, and the refill lock keeps the next check from refilling it again
+	ctx.checkBalance(lowWater, nil, refill, time.Minute)
+	assert.Equal(t, []sdk.AccAddress{low.Address}, refilled)
+
+	// The balance after the refill is the one of the testnet
+	balance, known := low.Balance()
+	assert.True(t, known)
+	assert.Equal(t, sdk.Coins{sdk.NewInt64Coin("steak", 1005)}, balance)
+
+	ctx.checkBalance(lowWater, nil, refill, time.Minute)
+	assert.Equal(t, []sdk.AccAddress{low.Address}, refilled)
+}
@@ -0,0 +1,77 @@
+package context
+
+import (
+	"bytes"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"strings"
+)
+
+// unconfirmedTxsLimit is the number of mempool transactions searched for a timed out transaction.
+const unconfirmedTxsLimit = 100
+
+// TxState tells if a broadcast transaction landed on the testnet.
+type TxState int
+
+const (
+	// TxUnknown means the node could not tell, for example because transaction indexing is disabled.
+	TxUnknown TxState = iota
+	// TxCommitted means the transaction is in a block.
+	TxCommitted
+	// TxPending means the transaction is in the mempool of the node.
+	TxPending
+	// TxMissing means the transaction is neither in a block nor in the mempool: it definitely did not land.
+	TxMissing
+)
+
+// TxNode is the part of the node RPC client used to look up transactions.
+type TxNode interface {
+	Tx(hash []byte, prove bool) (*ctypes.ResultTx, error)
+	UnconfirmedTxs(limit int) (*ctypes.ResultUnconfirmedTxs, error)
+}
+
+// LookupTx asks the network node at nodeURL if a transaction landed. It should be the node the transaction was
+// broadcast to, other nodes do not see its mempool.
+func (ctx *Context) LookupTx(nodeURL string, hash []byte) (TxState, *ctypes.ResultTx, error) {
+	node, err := ctx.NodeContext(nodeURL).GetNode()
+	if err != nil {
+		return TxUnknown, nil, err
+	}
+	return LookupTx(node, hash)
+}
+
+// LookupTx asks node if the transaction with hash is in a block or in the mempool.
+func LookupTx(node TxNode, hash []byte) (TxState, *ctypes.ResultTx, error) {
+	state, res, err := lookupCommittedTx(node, hash)
+	if state != TxMissing {
+		return state, res, err
+	}
+
+	unconfirmed, err := node.UnconfirmedTxs(unconfirmedTxsLimit)
+	if err != nil {
+		return TxUnknown, nil, err
+	}
+	for _, tx := range unconfirmed.Txs {
+		if bytes.Equal(tx.Hash(), hash) {
+			return TxPending, nil, nil
+		}
+	}
+	if len(unconfirmed.Txs) >= unconfirmedTxsLimit {
+		// The mempool has more transactions than we searched
+		return TxUnknown, nil, nil
+	}
+
+	// The transaction could have left the mempool for a block in the meantime
+	return lookupCommittedTx(node, hash)
+}
+
+// lookupCommittedTx searches the blocks for a transaction. TxMissing means the node does not know it.
+func lookupCommittedTx(node TxNode, hash []byte) (TxState, *ctypes.ResultTx, error) {
+	res, err := node.Tx(hash, false)
+	if err == nil {
+		return TxCommitted, res, nil
+	}
+	if strings.Contains(err.Error(), "not found") {
+		return TxMissing, nil, nil
+	}
+	return TxUnknown, nil, err
+}
@@ -0,0 +1,58 @@
+package context
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"testing"
+)
+
+// fakeTxNode is a TxNode with a fixed set of committed and mempool transactions.
+type fakeTxNode struct {
+	committed tmtypes.Txs
+	mempool   tmtypes.Txs
+	err       error
+}
+
+func (n *fakeTxNode) Tx(hash []byte, prove bool) (*ctypes.ResultTx, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	for _, tx := range n.committed {
+		if bytes.Equal(tx.Hash(), hash) {
+			return &ctypes.ResultTx{Hash: hash, Height: 10, Tx: tx}, nil
+		}
+	}
+	return nil, fmt.Errorf("Tx (%X) not found", hash)
+}
+
+func (n *fakeTxNode) UnconfirmedTxs(limit int) (*ctypes.ResultUnconfirmedTxs, error) {
+	return &ctypes.ResultUnconfirmedTxs{N: len(n.mempool), Txs: n.mempool}, nil
+}
+
+func TestLookupTx(t *testing.T) {
+	committed := tmtypes.Tx("committed")
+	pending := tmtypes.Tx("pending")
+	node := &fakeTxNode{committed: tmtypes.Txs{committed}, mempool: tmtypes.Txs{pending}}
+
+	state, res, err := LookupTx(node, committed.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, TxCommitted, state)
+	assert.Equal(t, int64(10), res.Height)
+
+	state, _, err = LookupTx(node, pending.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, TxPending, state)
+
+	state, _, err = LookupTx(node, tmtypes.Tx("missing").Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, TxMissing, state)
+
+	node.err = errors.New("transaction indexing is disabled")
+	state, _, err = LookupTx(node, committed.Hash())
+	assert.NotNil(t, err)
+	assert.Equal(t, TxUnknown, state)
+}
@@ -0,0 +1,107 @@
+package context
+
+import (
+	"fmt"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expectedSequencePattern finds the sequence number the testnet expects in an invalid sequence log:
+// "Invalid sequence. Got 5, expected 6"
+var expectedSequencePattern = regexp.MustCompile(`expected (\d+)`)
+
+// Error codes of transactions rejected by the testnet.
+const (
+	TxErrorInsufficientFunds = "insufficient_funds"
+	TxErrorSequenceMismatch  = "sequence_mismatch"
+	TxErrorOutOfGas          = "out_of_gas"
+	TxErrorInsufficientFee   = "insufficient_fee"
+	TxErrorUnknown           = "tx_failed"
+	TxErrorNotLanded         = "tx_not_landed"
+)
+
+// TxResult is what the result of a broadcast transaction means for the faucet.
+type TxResult struct {
+	// Err is the error reported to the client, nil if the transaction was committed.
+	Err *Error
+	// Status is the HTTP status reported to the client.
+	Status int
+	// Code and Log are the result code and log of the failed CheckTx or DeliverTx.
+	Code uint32
+	Log  string
+	// SequenceAdvanced is true if the transaction made it into a block, which uses up the sequence number
+	// even if DeliverTx failed.
+	SequenceAdvanced bool
+	// Broken is true if the account details have to be read again from the testnet before the next transaction.
+	Broken bool
+	// Drained is true if the account cannot pay the transaction.
+	Drained bool
+}
+
+// CheckTxResult examines the CheckTx and DeliverTx result codes of a committed broadcast.
+func CheckTxResult(res *ctypes.ResultBroadcastTxCommit) TxResult {
+	if res.CheckTx.Code != 0 {
+		return txError(res.CheckTx.Code, res.CheckTx.Log)
+	}
+	if res.DeliverTx.Code != 0 {
+		result := txError(res.DeliverTx.Code, res.DeliverTx.Log)
+		result.SequenceAdvanced = true
+		return result
+	}
+	return TxResult{
+		Status:           http.StatusOK,
+		SequenceAdvanced: true,
+	}
+}
+
+// txError maps a result code to a faucet error.
+func txError(code uint32, log string) TxResult {
+	result := TxResult{
+		Code: code,
+		Log:  log,
+	}
+
+	switch sdk.ABCICodeType(code) {
+	case sdk.ToABCICode(sdk.CodespaceRoot, sdk.CodeInsufficientCoins), sdk.ToABCICode(sdk.CodespaceRoot, sdk.CodeInsufficientFunds):
+		result.Err = NewError(TxErrorInsufficientFunds, "the faucet account does not have enough tokens, please try again later")
+		result.Status = http.StatusServiceUnavailable
+		result.Drained = true
+	case sdk.ToABCICode(sdk.CodespaceRoot, sdk.CodeInvalidSequence):
+		result.Err = NewError(TxErrorSequenceMismatch, "the faucet account is out of sync with the testnet, please try again")
+		result.Err.RetryAfter = 5 * time.Second
+		result.Status = http.StatusServiceUnavailable
+		result.Broken = true
+	case sdk.ToABCICode(sdk.CodespaceRoot, sdk.CodeOutOfGas):
+		result.Err = NewError(TxErrorOutOfGas, "the faucet transaction ran out of gas, raise GAS or GASADJUSTMENT")
+		result.Status = http.StatusInternalServerError
+	default:
+		if strings.Contains(strings.ToLower(log), "insufficient fee") {
+			// Nodes with minimum gas prices reject the transaction before it reaches the mempool
+			result.Err = NewError(TxErrorInsufficientFee, "the testnet rejected the faucet fee, raise GASPRICES or FEES")
+			result.Status = http.StatusInternalServerError
+			break
+		}
+		result.Err = NewError(TxErrorUnknown, fmt.Sprintf("the testnet rejected the faucet transaction (code %d)", code))
+		result.Status = http.StatusInternalServerError
+		result.Broken = true
+	}
+	return result
+}
+
+// ExpectedSequence parses the sequence number the testnet expects from the log of an invalid sequence rejection.
+func ExpectedSequence(log string) (sequence int64, found bool) {
+	match := expectedSequencePattern.FindStringSubmatch(log)
+	if match == nil {
+		return 0, false
+	}
+	sequence, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return sequence, true
+}
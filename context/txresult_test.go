@@ -0,0 +1,56 @@
+package context
+
+import (
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"net/http"
+	"testing"
+)
+
+func TestCheckTxResult(t *testing.T) {
+	code := func(c sdk.CodeType) uint32 {
+		return uint32(sdk.ToABCICode(sdk.CodespaceRoot, c))
+	}
+
+	result := CheckTxResult(&ctypes.ResultBroadcastTxCommit{})
+	assert.Nil(t, result.Err)
+	assert.True(t, result.SequenceAdvanced)
+
+	result = CheckTxResult(&ctypes.ResultBroadcastTxCommit{CheckTx: abci.ResponseCheckTx{Code: code(sdk.CodeInvalidSequence)}})
+	assert.Equal(t, TxErrorSequenceMismatch, result.Err.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, result.Status)
+	assert.False(t, result.SequenceAdvanced)
+	assert.True(t, result.Broken)
+
+	result = CheckTxResult(&ctypes.ResultBroadcastTxCommit{CheckTx: abci.ResponseCheckTx{Code: code(sdk.CodeInsufficientCoins)}})
+	assert.Equal(t, TxErrorInsufficientFunds, result.Err.Code)
+	assert.False(t, result.SequenceAdvanced)
+	assert.False(t, result.Broken)
+	assert.True(t, result.Drained)
+
+	result = CheckTxResult(&ctypes.ResultBroadcastTxCommit{DeliverTx: abci.ResponseDeliverTx{Code: code(sdk.CodeOutOfGas)}})
+	assert.Equal(t, TxErrorOutOfGas, result.Err.Code)
+	assert.True(t, result.SequenceAdvanced)
+	assert.False(t, result.Broken)
+
+	result = CheckTxResult(&ctypes.ResultBroadcastTxCommit{CheckTx: abci.ResponseCheckTx{Code: 0xFFFF, Log: "insufficient fee, got: 10steak required: 500steak"}})
+	assert.Equal(t, TxErrorInsufficientFee, result.Err.Code)
+	assert.False(t, result.SequenceAdvanced)
+	assert.False(t, result.Broken)
+
+	result = CheckTxResult(&ctypes.ResultBroadcastTxCommit{DeliverTx: abci.ResponseDeliverTx{Code: 0xFFFF}})
+	assert.Equal(t, TxErrorUnknown, result.Err.Code)
+	assert.True(t, result.SequenceAdvanced)
+	assert.True(t, result.Broken)
+}
+
+func TestExpectedSequence(t *testing.T) {
+	sequence, found := ExpectedSequence(`{"codespace":1,"code":3,"abci_code":65539,"message":"Invalid sequence. Got 5, expected 7"}`)
+	assert.True(t, found)
+	assert.Equal(t, int64(7), sequence)
+
+	_, found = ExpectedSequence("signature verification failed")
+	assert.False(t, found)
+}
@@ -1,8 +1,6 @@
 // Default package implements versioning primitives.
 package defaults
 
-import "github.com/throttled/throttled"
-
 // Major version number.
 const Major = "0"
 
@@ -18,8 +16,53 @@ var Release = "0-dev"
 // Version compiled into a string.
 var Version = Major + "." + Minor + "." + Release
 
-// LimiterMaxRate sets the throttling limit
-var LimiterMaxRate = throttled.PerMin(10)
+// LimiterMaxRate sets the throttling limit per minute and client IP without RATELIMITS and LIMITERRATE.
+var LimiterMaxRate = 10
 
 // LimiterMaxBurst sets the maximum burst when the limit has been reached.
 var LimiterMaxBurst = 0
+
+// RateLimitIP counts the requests of every client IP address.
+const RateLimitIP = "ip"
+
+// RateLimitSubnet counts the requests of every IPv4 /24 or IPv6 /64 network.
+const RateLimitSubnet = "subnet"
+
+// RateLimitAddress counts the claims for every recipient address.
+const RateLimitAddress = "address"
+
+// RateLimitGlobal counts the requests of all clients together.
+const RateLimitGlobal = "global"
+
+// LockBackendDynamoDB stores the distributed mutexes in AWS DynamoDB. This is the default.
+const LockBackendDynamoDB = "dynamodb"
+
+// LockBackendRedis stores the distributed mutexes in RedisDB.
+const LockBackendRedis = "redis"
+
+// LockBackendMemory keeps the mutexes in-process. Only use it with a single webserver instance.
+const LockBackendMemory = "memory"
+
+// CaptchaRecaptcha verifies claims with Google reCAPTCHA v2. This is the default.
+const CaptchaRecaptcha = "recaptcha"
+
+// CaptchaRecaptchaV3 verifies claims with Google reCAPTCHA v3 and checks the score and the action.
+const CaptchaRecaptchaV3 = "recaptchav3"
+
+// CaptchaHCaptcha verifies claims with hCaptcha.
+const CaptchaHCaptcha = "hcaptcha"
+
+// CaptchaTurnstile verifies claims with Cloudflare Turnstile.
+const CaptchaTurnstile = "turnstile"
+
+// AccountSourceLCD reads account state from /accounts of the LCD node. This is the default if LCDNODE is set.
+const AccountSourceLCD = "lcd"
+
+// AccountSourceRPC reads account state from the auth store of the node with abci_query.
+const AccountSourceRPC = "rpc"
+
+// ModuleAccounts are the module accounts that claims are refused for, unless MODULEACCOUNTS lists others.
+var ModuleAccounts = []string{"fee_collector", "distribution", "bonded_tokens_pool", "not_bonded_tokens_pool", "gov", "mint"}
+
+// SourceIPHeader carries the source IP of API Gateway requests from LambdaHandler to the handlers.
+const SourceIPHeader = "X-F11-Source-Ip"
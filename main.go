@@ -13,8 +13,10 @@ import (
 	sdkversion "github.com/cosmos/cosmos-sdk/version"
 	"github.com/cosmos/faucet-backend/defaults"
 	tendermintversion "github.com/tendermint/tendermint/version"
+	"io/ioutil"
 	"log"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/cosmos/faucet-backend/context"
@@ -57,10 +59,35 @@ func LambdaHandler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyRes
 		lambdaInitialized = true
 	}
 
-	return lambdaProxy(req)
+	return lambdaProxy(withSourceIP(req))
 
 }
 
+// withSourceIP passes the source IP that API Gateway saw to the handlers in the defaults.SourceIPHeader header.
+// A copy of the header sent by the client is dropped, so it cannot pick its own IP address.
+func withSourceIP(req events.APIGatewayProxyRequest) events.APIGatewayProxyRequest {
+	headers := make(map[string]string)
+	for name, value := range req.Headers {
+		if !strings.EqualFold(name, defaults.SourceIPHeader) {
+			headers[name] = value
+		}
+	}
+	headers[defaults.SourceIPHeader] = req.RequestContext.Identity.SourceIP
+	req.Headers = headers
+
+	if req.MultiValueHeaders != nil {
+		multiValueHeaders := make(map[string][]string)
+		for name, values := range req.MultiValueHeaders {
+			if !strings.EqualFold(name, defaults.SourceIPHeader) {
+				multiValueHeaders[name] = values
+			}
+		}
+		multiValueHeaders[defaults.SourceIPHeader] = []string{req.RequestContext.Identity.SourceIP}
+		req.MultiValueHeaders = multiValueHeaders
+	}
+	return req
+}
+
 // WebserverHandler is the function that is called when the `--webserver` parameter is invoked.
 // It sets up a local webserver for handling incoming requests.
 func WebserverHandler(localCtx *context.InitialContext) {
@@ -74,6 +101,9 @@ func WebserverHandler(localCtx *context.InitialContext) {
 
 	r := AddRoutes(ctx)
 
+	// Process /v2/claim jobs in the background
+	go RunClaimWorkers(ctx, make(chan struct{}))
+
 	srv := &http.Server{
 		Addr: fmt.Sprintf("%s:%d", localCtx.WebserverIp, localCtx.WebserverPort),
 		// Good practice to set timeouts to avoid Slowloris attacks.
@@ -111,6 +141,18 @@ func SendTransactionHandler(localCtx *context.InitialContext) {
 		log.Fatalf("initialization failed: %v\n", err)
 	}
 
+	// Multi-chain mode: send on the chain selected with --chain
+	if len(ctx.Chains) > 0 {
+		chain, found := ctx.Chain(localCtx.Chain)
+		if !found {
+			log.Fatalf("chain %q is not configured, select one with --chain", localCtx.Chain)
+		}
+		ctx, err = chain.Context(newChainContext(ctx))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	height, hash, errType, err := V1SendTx(ctx, localCtx.Send)
 	if err != nil {
 		log.Fatalf("(%d): %v", errType, err)
@@ -119,6 +161,67 @@ func SendTransactionHandler(localCtx *context.InitialContext) {
 	return
 }
 
+// SetRateLimitsHandler is the function that is called when the `--ratelimits` parameter is invoked.
+// It stores the rate-limit policies of a JSON file in the key-value store, where the running faucets pick them up
+// within RATELIMITRELOAD seconds, and then exits. An empty file goes back to RATELIMITS.
+func SetRateLimitsHandler(localCtx *context.InitialContext) {
+	log.Print("Set rate-limit policies")
+
+	var err error
+	localCtx.LocalExecution = true // Read config from local file
+	ctx, err := Initialization(localCtx)
+	if err != nil {
+		log.Fatalf("initialization failed: %v\n", err)
+	}
+
+	// Multi-chain mode: every chain has its own policies, select one with --chain
+	if len(ctx.Chains) > 0 {
+		chain, found := ctx.Chain(localCtx.Chain)
+		if !found {
+			log.Fatalf("chain %q is not configured, select one with --chain", localCtx.Chain)
+		}
+		ctx, err = chain.Context(newChainContext(ctx))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	policies, err := ioutil.ReadFile(localCtx.RateLimits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ctx.SetRateLimitPolicies(string(policies))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rate-limit policies set from %s", localCtx.RateLimits)
+}
+
+// WorkerHandler is the function that is called when the `--worker` parameter is invoked.
+// It processes queued /v2/claim jobs, for example for AWS Lambda functions that cannot process them in the background.
+func WorkerHandler(localCtx *context.InitialContext) {
+	log.Print("worker execution start")
+
+	var err error
+	localCtx.LocalExecution = true // Read config from local file
+	ctx, err := Initialization(localCtx)
+	if err != nil {
+		log.Fatalf("initialization failed: %v\n", err)
+	}
+
+	stop := make(chan struct{})
+	var gracefulStop = make(chan os.Signal)
+	signal.Notify(gracefulStop, syscall.SIGTERM)
+	signal.Notify(gracefulStop, syscall.SIGINT)
+	go func() {
+		sig := <-gracefulStop
+		log.Printf("caught signal: %+v", sig)
+		close(stop)
+	}()
+
+	RunClaimWorkers(ctx, stop)
+}
+
 func main() {
 	var versionSwitch bool //--version
 	var extract string     //--extract
@@ -128,6 +231,9 @@ func main() {
 	flag.BoolVar(&versionSwitch, "version", false, "Return version number and exit.")
 	flag.StringVar(&extract, "extract", "", "Extract private key bytes from your local storage. Get passphrase from $PASSPHRASE environment variable")
 	flag.StringVar(&initialCtx.Send, "send", "", "send a transaction with the local configuration")
+	flag.BoolVar(&initialCtx.Worker, "worker", false, "process queued /v2/claim jobs with the local configuration")
+	flag.StringVar(&initialCtx.Chain, "chain", "", "chain to send the transaction on or set the rate-limit policies of in multi-chain mode")
+	flag.StringVar(&initialCtx.RateLimits, "ratelimits", "", "store the rate-limit policies of this JSON file for the running faucets (empty file: back to RATELIMITS)")
 
 	flag.BoolVar(&initialCtx.LocalExecution, "webserver", false, "run a local web-server instead of as an AWS Lambda function")
 	flag.StringVar(&initialCtx.ConfigFile, "config", "f11.conf", "read config from this local file")
@@ -160,13 +266,21 @@ func main() {
 			//--send
 			if initialCtx.Send != "" {
 				SendTransactionHandler(initialCtx)
+			} else if initialCtx.RateLimits != "" {
+				//--ratelimits
+				SetRateLimitsHandler(initialCtx)
 			} else {
-				//--webserver
-				if initialCtx.LocalExecution {
-					WebserverHandler(initialCtx)
+				//--worker
+				if initialCtx.Worker {
+					WorkerHandler(initialCtx)
 				} else {
-					//Lambda function on AWS
-					lambda.Start(LambdaHandler)
+					//--webserver
+					if initialCtx.LocalExecution {
+						WebserverHandler(initialCtx)
+					} else {
+						//Lambda function on AWS
+						lambda.Start(LambdaHandler)
+					}
 				}
 			}
 		}
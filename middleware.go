@@ -1,27 +1,20 @@
 package main
 
 import (
+	"fmt"
 	"github.com/cosmos/faucet-backend/context"
-	"github.com/cosmos/faucet-backend/defaults"
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"github.com/throttled/throttled"
 	"github.com/throttled/throttled/store/goredisstore"
 	"github.com/throttled/throttled/store/memstore"
-	"github.com/tomasen/realip"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 )
 
-// Create logs for each request
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[%s] %s", realip.FromRequest(r), r.RequestURI)
-		next.ServeHTTP(w, r)
-	})
-}
-
 type addContext struct {
 	ctx         *context.Context
 	Contextware func(ctx *context.Context, next http.Handler) http.Handler
@@ -31,16 +24,73 @@ func (fn addContext) Middleware(next http.Handler) http.Handler {
 	return fn.Contextware(fn.ctx, next)
 }
 
-func createThrottledMiddleware(ctx *context.Context) mux.MiddlewareFunc {
-	throttledContextMiddleware := addContext{
+// Create logs for each request
+func createLoggingMiddleware(ctx *context.Context) mux.MiddlewareFunc {
+	loggingContextMiddleware := addContext{
 		ctx: ctx,
 		Contextware: func(ctx *context.Context, next http.Handler) http.Handler {
-			return ctx.HttpRateLimiter.RateLimit(next)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				log.Printf("[%s] %s", ctx.ClientIP(r), r.RequestURI)
+				next.ServeHTTP(w, r)
+			})
 		},
 	}
+	return loggingContextMiddleware.Middleware
+}
+
+func createThrottledMiddleware(ctx *context.Context) mux.MiddlewareFunc {
+	throttledContextMiddleware := addContext{
+		ctx:         ctx,
+		Contextware: rateLimit,
+	}
 	return throttledContextMiddleware.Middleware
 }
 
+// rateLimit refuses requests over the ip, subnet and global rate-limit policies of the context.
+// The X-RateLimit headers show the state of the most restrictive policy.
+func rateLimit(ctx *context.Context, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := ctx.RateLimiter.Check(routeTemplate(r), ctx.ClientIP(r))
+		if result != nil {
+			setRateLimitHeaders(w, *result)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if _, ok := err.(*context.Error); ok {
+				status = http.StatusTooManyRequests
+			}
+			context.Handler{ctx, func(*context.Context, http.ResponseWriter, *http.Request) (int, error) {
+				return status, err
+			}}.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setRateLimitHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (in seconds) headers.
+func setRateLimitHeaders(w http.ResponseWriter, result throttled.RateLimitResult) {
+	if result.Limit >= 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	}
+	if result.Remaining >= 0 {
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	}
+	if result.ResetAfter >= 0 {
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+	}
+}
+
+// routeTemplate returns the path template of the route that matched a request, like /v1/{chain}/claim.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
 // Todo: Let the API Gateway handle CORS, instead of handling it in code.
 // Create CORS middleware
 func createCORSMiddleware(ctx *context.Context) mux.MiddlewareFunc {
@@ -57,14 +107,20 @@ func createCORSMiddleware(ctx *context.Context) mux.MiddlewareFunc {
 	return corsContextMiddleware.Middleware
 }
 
-// Todo: Better define IP throttling requirements and storage
-// Create throttled rate limiter with redisstore for remote execution
-func createRedisStore(ctx *context.Context) (throttled.GCRAStore, error) {
-	return goredisstore.New(redis.NewClient(&redis.Options{
+// Create RedisDB client for the throttled limiter storage and the redis lock backend
+func createRedisClient(ctx *context.Context) *redis.Client {
+	return redis.NewClient(&redis.Options{
 		Addr:     ctx.Cfg.RedisEndpoint,
 		Password: ctx.Cfg.RedisPassword,
 		DB:       0,
-	}), ctx.TestnetName)
+	})
+}
+
+// Todo: Better define IP throttling requirements and storage
+// Create throttled rate limiter with redisstore for remote execution
+// The chain name keeps the limits of the chains apart in multi-chain mode.
+func createRedisStore(ctx *context.Context) (throttled.GCRAStore, error) {
+	return goredisstore.New(ctx.RedisClient, ctx.ChainName)
 }
 
 // Create throttled rate limiter with memstore for local execution
@@ -72,18 +128,59 @@ func createMemStore() (throttled.GCRAStore, error) {
 	return memstore.New(65536)
 }
 
-// Finish creating throttled rate limiter
+// createThrottledStore creates the rate limiter store of a context: in RedisDB, or in memory with --no-rdb.
+func createThrottledStore(ctx *context.Context) (err error) {
+	if ctx.RedisClient == nil {
+		ctx.Store, err = createMemStore()
+	} else {
+		ctx.Store, err = createRedisStore(ctx)
+	}
+	return
+}
+
+// Finish creating throttled rate limiter with the rate-limit policies
 func createThrottledLimiter(ctx *context.Context) (err error) {
-	var rateLimiter *throttled.GCRARateLimiter
-	rateLimiter, err = throttled.NewGCRARateLimiter(ctx.Store, throttled.RateQuota{MaxRate: defaults.LimiterMaxRate, MaxBurst: defaults.LimiterMaxBurst})
+	ctx.RateLimiter, err = ctx.NewRateLimiter()
+	return
+}
+
+// limitRoot applies the rate limiter of the root context to a route that belongs to no chain in multi-chain mode.
+// In single chain mode the throttled middleware limits all routes.
+func limitRoot(ctx *context.Context, h http.Handler) http.Handler {
+	if ctx.DisableLimiter || len(ctx.Chains) == 0 {
+		return h
+	}
+	return rateLimit(ctx, h)
+}
+
+// chainHandler serves a request of the chain named in the URL in multi-chain mode.
+// Unknown chains return 404, chains that cannot be initialized return 503 without affecting the others.
+type chainHandler struct {
+	root *context.Context
+	H    func(*context.Context, http.ResponseWriter, *http.Request) (int, error)
+}
+
+func (fn chainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["chain"]
+	chain, found := fn.root.Chain(name)
+	if !found {
+		context.Handler{fn.root, func(*context.Context, http.ResponseWriter, *http.Request) (int, error) {
+			return http.StatusNotFound, context.NewError("chain_not_found", fmt.Sprintf("chain %s is not served by this faucet", name))
+		}}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, err := chain.Context(newChainContext(fn.root))
 	if err != nil {
+		context.Handler{fn.root, func(*context.Context, http.ResponseWriter, *http.Request) (int, error) {
+			return http.StatusServiceUnavailable, context.NewError("chain_unavailable", err.Error())
+		}}.ServeHTTP(w, r)
 		return
 	}
-	ctx.HttpRateLimiter = throttled.HTTPRateLimiter{
-		DeniedHandler: nil,
-		Error:         nil,
-		RateLimiter:   rateLimiter,
-		VaryBy:        &throttled.VaryBy{Headers: []string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"}},
+
+	var next http.Handler = context.Handler{ctx, fn.H}
+	if !ctx.DisableLimiter {
+		next = rateLimit(ctx, next)
 	}
-	return
+	next.ServeHTTP(w, r)
 }
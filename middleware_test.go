@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/cosmos/faucet-backend/config"
+	"github.com/cosmos/faucet-backend/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/throttled/throttled/store/memstore"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRateLimitHeaders tests that the rate-limit middleware shows the most restrictive policy in the X-RateLimit headers.
+func TestRateLimitHeaders(t *testing.T) {
+	ctx := context.New()
+	var err error
+	ctx.Store, err = memstore.New(65536)
+	assert.Nil(t, err)
+	ctx.Cfg.RateLimits = `[{"scope":"ip","rate":2,"burst":2},{"scope":"global","rate":100,"burst":100}]`
+	ctx.RateLimiter, err = ctx.NewRateLimiter()
+	assert.Nil(t, err)
+	handler := rateLimit(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, remaining := range []string{"2", "1", "0"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "3", rr.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, remaining, rr.Header().Get("X-RateLimit-Remaining"))
+		assert.NotEmpty(t, rr.Header().Get("X-RateLimit-Reset"))
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+}
+
+// TestLimitRoot tests that the routes outside the chains are rate limited in multi-chain mode.
+func TestLimitRoot(t *testing.T) {
+	ctx := context.New()
+	var err error
+	ctx.Store, err = memstore.New(65536)
+	assert.Nil(t, err)
+	ctx.Cfg.RateLimits = `[{"scope":"ip","rate":1}]`
+	ctx.RateLimiter, err = ctx.NewRateLimiter()
+	assert.Nil(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// In single chain mode the throttled middleware limits the route
+	handler := limitRoot(ctx, ok)
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	ctx.Chains = []*context.Chain{context.NewChain(&config.Config{Name: "gaia"})}
+	handler = limitRoot(ctx, ok)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
@@ -7,18 +7,18 @@ import (
 	sdkCtx "github.com/cosmos/cosmos-sdk/client/context"
 	"github.com/cosmos/cosmos-sdk/client/keys"
 	"github.com/cosmos/cosmos-sdk/cmd/gaia/app"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	authcmd "github.com/cosmos/cosmos-sdk/x/auth/client/cli"
 	authctx "github.com/cosmos/cosmos-sdk/x/auth/client/context"
 	"github.com/cosmos/faucet-backend/config"
 	"github.com/cosmos/faucet-backend/context"
 	"github.com/cosmos/faucet-backend/defaults"
-	"github.com/dpapathanasiou/go-recaptcha"
 	"github.com/gorilla/mux"
-	"github.com/greg-szabo/dsync/ddb/sync"
 	"log"
 	"net/http"
 	"os"
 	"os/user"
+	"strings"
 	"time"
 )
 
@@ -32,7 +32,7 @@ func MainHandler(ctx *context.Context, w http.ResponseWriter, r *http.Request) (
 		Version string `json:"version"`
 	}{
 		Message: "",
-		Name:    ctx.TestnetName,
+		Name:    ctx.TestnetName(),
 		Version: defaults.Version,
 	})
 	return
@@ -43,13 +43,27 @@ func AddRoutes(ctx *context.Context) (r *mux.Router) {
 
 	// Root and routes
 	r = mux.NewRouter()
-	r.Handle("/", context.Handler{ctx, MainHandler})
-	r.Handle("/v1/claim", context.Handler{ctx, V1ClaimHandler}).Methods("POST", "OPTIONS")
+	r.Handle("/", limitRoot(ctx, context.Handler{ctx, MainHandler}))
+	if len(ctx.Chains) == 0 {
+		r.Handle("/v1/claim", context.Handler{ctx, V1ClaimHandler}).Methods("POST", "OPTIONS")
+		r.Handle("/v1/challenge", context.Handler{ctx, V1ChallengeHandler}).Methods("GET", "OPTIONS")
+		r.Handle("/v1/status", context.Handler{ctx, V1StatusHandler}).Methods("GET", "OPTIONS")
+		r.Handle("/v2/claim", context.Handler{ctx, V2ClaimHandler}).Methods("POST", "OPTIONS")
+		r.Handle("/v2/claim/{id}", context.Handler{ctx, V2ClaimStatusHandler}).Methods("GET", "OPTIONS")
+	} else {
+		r.Handle("/v1/chains", limitRoot(ctx, context.Handler{ctx, V1ChainsHandler})).Methods("GET", "OPTIONS")
+		r.Handle("/v1/{chain}/claim", chainHandler{ctx, V1ClaimHandler}).Methods("POST", "OPTIONS")
+		r.Handle("/v1/{chain}/challenge", chainHandler{ctx, V1ChallengeHandler}).Methods("GET", "OPTIONS")
+		r.Handle("/v1/{chain}/status", chainHandler{ctx, V1StatusHandler}).Methods("GET", "OPTIONS")
+		r.Handle("/v2/{chain}/claim", chainHandler{ctx, V2ClaimHandler}).Methods("POST", "OPTIONS")
+		r.Handle("/v2/{chain}/claim/{id}", chainHandler{ctx, V2ClaimStatusHandler}).Methods("GET", "OPTIONS")
+	}
 
 	// Finally
-	r.Use(loggingMiddleware)
+	r.Use(createLoggingMiddleware(ctx))
 	r.Use(createCORSMiddleware(ctx))
-	if !ctx.DisableLimiter {
+	// In multi-chain mode every chain has its own rate limiter, see chainHandler and limitRoot.
+	if !ctx.DisableLimiter && len(ctx.Chains) == 0 {
 		r.Use(createThrottledMiddleware(ctx))
 	}
 	http.Handle("/", r)
@@ -87,78 +101,199 @@ func Initialization(initialContext *context.InitialContext) (ctx *context.Contex
 		}
 	}
 
-	printCfg := *ctx.Cfg
+	logConfig(ctx.Cfg)
+	for _, chainCfg := range ctx.Cfg.Chains {
+		logConfig(chainCfg)
+	}
+
+	ctx.TrustedProxies, err = context.ParseTrustedProxies(ctx.Cfg.TrustedProxies)
+	if err != nil {
+		return
+	}
+	if !initialContext.LocalExecution {
+		// LambdaHandler passes the source IP of API Gateway in this header
+		ctx.SourceIPHeader = defaults.SourceIPHeader
+	}
+
+	if !initialContext.DisableRDb {
+		ctx.RedisClient = createRedisClient(ctx)
+	}
+
+	ctx.Cdc = app.MakeCodec()
+
+	ctx.Captcha, err = ctx.NewVerifier()
+	if err != nil {
+		return
+	}
+
+	// Single chain mode
+	if len(ctx.Cfg.Chains) == 0 {
+		err = InitializeChain(ctx)
+		if err != nil {
+			return
+		}
+		log.Print("initialized context")
+		return
+	}
+
+	// Multi-chain mode: the routes that belong to no chain, / and /v1/chains, have the rate limiter of the root context
+	err = createThrottledStore(ctx)
+	if err != nil {
+		return
+	}
+	ctx.ChainKV = ctx.NewKVStore(ctx.ChainPrefix())
+	err = createThrottledLimiter(ctx)
+	if err != nil {
+		return
+	}
+
+	// A chain that cannot be initialized now is retried later, the others are served.
+	for _, chainCfg := range ctx.Cfg.Chains {
+		chain := context.NewChain(chainCfg)
+		ctx.Chains = append(ctx.Chains, chain)
+		_, chainErr := chain.Context(newChainContext(ctx))
+		if chainErr != nil {
+			log.Print(chainErr)
+		}
+	}
+	log.Printf("initialized context with %d chains", len(ctx.Chains))
+
+	return
+}
+
+// logConfig prints the configuration with the secrets redacted.
+func logConfig(cfg *config.Config) {
+	printCfg := *cfg
 	printCfg.PrivateKey = redact(printCfg.PrivateKey)
+	printCfg.PrivateKeys = []string{redact(strings.Join(printCfg.PrivateKeys, ","))}
+	printCfg.Mnemonic = redact(printCfg.Mnemonic)
+	printCfg.KeyPassphrase = redact(printCfg.KeyPassphrase)
+	printCfg.RemoteSignerToken = redact(printCfg.RemoteSignerToken)
 	printCfg.RedisEndpoint = redact(printCfg.RedisEndpoint)
 	printCfg.RedisPassword = redact(printCfg.RedisPassword)
 	printCfg.RecaptchaSecret = redact(printCfg.RecaptchaSecret)
+	printCfg.CaptchaSecret = redact(printCfg.CaptchaSecret)
+	printCfg.PowSecret = redact(printCfg.PowSecret)
+	printCfg.AlertWebhook = redact(printCfg.AlertWebhook)
+	printCfg.AlertSlackWebhook = redact(printCfg.AlertSlackWebhook)
+	printCfg.AlertSMTPPassword = redact(printCfg.AlertSMTPPassword)
+	printCfg.TreasuryKey = redact(printCfg.TreasuryKey)
+	printCfg.TreasuryKeyPass = redact(printCfg.TreasuryKeyPass)
+	printCfg.TreasuryToken = redact(printCfg.TreasuryToken)
+	printCfg.Chains = nil
 	log.Printf("%+v", printCfg)
+}
 
-	if initialContext.DisableRDb {
-		ctx.Store, err = createMemStore()
-		if err != nil {
-			return
-		}
-	} else {
-		ctx.Store, err = createRedisStore(ctx)
+// newChainContext returns the function that initializes the Context of a chain in multi-chain mode.
+// Chains share the RedisDB connection and the codec of the root context.
+func newChainContext(root *context.Context) context.ChainInitializer {
+	return func(chain *context.Chain) (ctx *context.Context, err error) {
+		ctx = context.New()
+		ctx.ChainName = chain.Name
+		ctx.Cfg = chain.Cfg
+		ctx.DisableLimiter = root.DisableLimiter
+		ctx.DisableRecaptcha = root.DisableRecaptcha
+		ctx.DisableSend = root.DisableSend
+		ctx.TrustedProxies = root.TrustedProxies
+		ctx.SourceIPHeader = root.SourceIPHeader
+		ctx.RedisClient = root.RedisClient
+		ctx.Cdc = root.Cdc
+		ctx.Captcha = root.Captcha
+
+		err = InitializeChain(ctx)
 		if err != nil {
 			return
 		}
-
+		log.Printf("initialized chain %s", chain.Name)
+		return
 	}
+}
 
-	ctx.Cdc = app.MakeCodec()
+// InitializeChain sets up connectivity to the testnet of a context: testnet name, wallets, rate limiter.
+func InitializeChain(ctx *context.Context) (err error) {
 
-	err = ctx.GetTestnetName()
+	err = createThrottledStore(ctx)
 	if err != nil {
-		log.Print("underlying full node seems to have issues")
 		return
 	}
 
-	log.Printf("config loaded, testnet name: %s", ctx.TestnetName)
-
-	ctx.SequenceMutex = sync.Mutex{
-		Name:      fmt.Sprintf("%s-%s-sequence", ctx.Cfg.ApiEnvironment, ctx.TestnetName),
-		AWSRegion: ctx.Cfg.AWSRegion,
-		Expiry:    60 * time.Second,
-	}.WithTimeout(70 * time.Second)
-
-	ctx.AccountNumberMutex = sync.Mutex{
-		Name:      fmt.Sprintf("%s-%s-accountnumber", ctx.Cfg.ApiEnvironment, ctx.TestnetName),
-		AWSRegion: ctx.Cfg.AWSRegion,
-		Expiry:    1 * time.Second,
-	}.WithTimeout(3 * time.Second)
-
-	ctx.BrokenFlagMutex = sync.Mutex{
-		Name:      fmt.Sprintf("%s-%s-brokenflag", ctx.Cfg.ApiEnvironment, ctx.TestnetName),
-		AWSRegion: ctx.Cfg.AWSRegion,
-		Expiry:    1 * time.Second,
-	}.WithTimeout(3 * time.Second)
+	// Requests go to the healthiest NODE and LCDNODE endpoint
+	ctx.Nodes = context.NewEndpointPool("node", context.ParseEndpoints(ctx.Cfg.Node), context.ProbeNode)
+	ctx.LCDNodes = context.NewEndpointPool("lcd", context.ParseEndpoints(ctx.Cfg.LCDNode), context.ProbeLCD)
 
-	err = ctx.CheckAndFixAccountDetails()
+	err = ctx.GetTestnetName()
 	if err != nil {
+		log.Print("underlying full node seems to have issues")
 		return
 	}
 
-	// This is not really a Mutex. We use the Mutex as a database store:
-	// read the value once and reuse it without checking the database.
-	ctx.AccountNumberMutex.Lock()
-	ctx.AccountNumberMutex.Unlock()
+	log.Printf("config loaded, testnet name: %s", ctx.TestnetName())
+	ctx.Nodes.SetNetwork(ctx.TestnetName())
 
 	// Create CLIContext
 	cliContext := sdkCtx.NewCLIContext().
 		WithCodec(ctx.Cdc).
 		WithLogger(os.Stdout).
 		WithAccountDecoder(authcmd.GetAccountDecoder(ctx.Cdc)).
-		WithNodeURI(ctx.Cfg.Node)
+		WithNodeURI(ctx.Nodes.Current())
 	ctx.CLIContext = &cliContext
 
-	// Create TxContest
+	ctx.AccountReader, err = ctx.NewAccountReader()
+	if err != nil {
+		return
+	}
+
+	// The key-value store and the TxContext belong to the testnet, a testnet reset replaces them
+	ctx.ChainKV = ctx.NewKVStore(ctx.ChainPrefix())
 	txCtx := authctx.TxContext{
-		ChainID: ctx.TestnetName,
-		Gas:     20000,
+		ChainID: ctx.TestnetName(),
+		Gas:     ctx.Cfg.Gas,
 	}.WithCodec(ctx.Cdc)
-	ctx.TxContest = &txCtx
+	ctx.SetTestnet(context.Testnet{
+		Name:      ctx.TestnetName(),
+		KV:        ctx.NewKVStore(ctx.LockPrefix()),
+		TxContext: &txCtx,
+	})
+
+	err = ctx.LoadAccounts()
+	if err != nil {
+		return
+	}
+
+	err = ctx.SetupAccountMutexes()
+	if err != nil {
+		return
+	}
+
+	err = ctx.LoadTreasury()
+	if err != nil {
+		return
+	}
+
+	for _, acc := range ctx.Accounts {
+		err = ctx.CheckAndFixAccountDetails(acc)
+		if err != nil {
+			return
+		}
+
+		// This is not really a Mutex. We use the Mutex as a database store:
+		// read the value once and reuse it without checking the database.
+		acc.AccountNumberMutex.Lock()
+		acc.AccountNumberMutex.Unlock()
+	}
+
+	// Check the fee settings before the first claim
+	_, err = ctx.TxFee(ctx.Cfg.Gas)
+	if err != nil {
+		return
+	}
+
+	// Combine claims into multi-recipient transactions
+	if ctx.Cfg.BatchSize > 1 {
+		ctx.Batcher = context.NewBatcher(time.Duration(ctx.Cfg.BatchWindow)*time.Millisecond, int(ctx.Cfg.BatchSize), len(ctx.Accounts), func(toBech32s []string) (int64, string, int, error) {
+			return V1SendBatchTx(ctx, toBech32s)
+		})
+	}
 
 	// Create Throttled limiter
 	err = createThrottledLimiter(ctx)
@@ -166,11 +301,38 @@ func Initialization(initialContext *context.InitialContext) (ctx *context.Contex
 		return
 	}
 
-	recaptcha.Init(ctx.Cfg.RecaptchaSecret)
+	// Nothing can fail from here on: the background work only starts for a context that is used.
+	// It runs until ctx.Stop is called.
+	startBackgroundWork(ctx)
+	return
+}
 
-	log.Print("initialized context")
+// startBackgroundWork starts the health checks, the testnet watch, the balance monitoring and the batcher of an
+// initialized context.
+func startBackgroundWork(ctx *context.Context) {
+	// Check the health of the endpoints in the background
+	if ctx.Cfg.HealthInterval > 0 {
+		healthCheckInterval := time.Duration(ctx.Cfg.HealthInterval) * time.Second
+		go ctx.Nodes.Run(healthCheckInterval, ctx.Done())
+		go ctx.LCDNodes.Run(healthCheckInterval, ctx.Done())
 
-	return
+		// Re-initialize when the testnet is reset
+		go ctx.WatchTestnet(healthCheckInterval, ctx.Done())
+	}
+
+	// Alert the operators when the faucet runs low, and top up the faucet accounts from the treasury
+	if ctx.Cfg.BalanceInterval > 0 {
+		refill := func(acc *context.Account, amount sdk.Coins) (int64, string, error) {
+			return V1RefillTx(ctx, acc, amount)
+		}
+		go ctx.MonitorBalance(time.Duration(ctx.Cfg.BalanceInterval)*time.Second, ctx.NewAlertSinks(), refill, ctx.Done())
+	}
+
+	// Combine claims into multi-recipient transactions
+	if ctx.Batcher != nil {
+		go ctx.Batcher.Run(ctx.Done())
+		log.Printf("batching up to %d claims every %d ms", ctx.Cfg.BatchSize, ctx.Cfg.BatchWindow)
+	}
 }
 
 // GetPrivkeyBytesFromString translates a string into a set of private key bytes.
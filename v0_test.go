@@ -36,6 +36,6 @@ func TestMainHandler(t *testing.T) {
 	status := rr.Code
 	assert.Equal(t,status,http.StatusOK)
 
-	expected := "{\"message\":\"\",\"name\":\"" + ctx.TestnetName + "\",\"version\":\"" + defaults.Version + "\"}\n"
+	expected := "{\"message\":\"\",\"name\":\"" + ctx.TestnetName() + "\",\"version\":\"" + defaults.Version + "\"}\n"
 	assert.Equal(t, expected, rr.Body.String())
 }
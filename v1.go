@@ -3,17 +3,16 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/cosmos/cosmos-sdk/x/auth"
 	"time"
 
 	"github.com/cosmos/cosmos-sdk/x/bank/client"
 	f11context "github.com/cosmos/faucet-backend/context"
-	"github.com/dpapathanasiou/go-recaptcha"
-	"github.com/tendermint/tendermint/crypto/encoding/amino"
 	"github.com/tendermint/tendermint/libs/bech32"
 	ctypes "github.com/tendermint/tendermint/rpc/core/types"
-	"github.com/tomasen/realip"
+	tmtypes "github.com/tendermint/tendermint/types"
 	"log"
 	"net/http"
 )
@@ -28,146 +27,573 @@ const broadcast_error = "broadcasting transaction timed out"
 
 // V1ClaimHandler processes incoming POST requests from the /v1/claim endpoint.
 func V1ClaimHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	encodedAddress, clientIP, status, err := V1ValidateClaim(ctx, r)
+	if err != nil {
+		return
+	}
+
+	message := "transaction committed"
+	height, hash, status, err := V1ProcessClaim(ctx, encodedAddress, clientIP)
+	if err != nil {
+		return
+	}
+
+	hexAddress, err := f11context.Bech32ToHex(encodedAddress)
+	if err != nil {
+		status = http.StatusInternalServerError
+		return
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Message    string `json:"message"`
+		Hash       string `json:"hash"`
+		Height     int64  `json:"height"`
+		Address    string `json:"address"`
+		HexAddress string `json:"hex_address"`
+	}{
+		Message:    message,
+		Height:     height,
+		Hash:       hash,
+		Address:    encodedAddress,
+		HexAddress: hexAddress,
+	})
+	return
+}
+
+// V1ChainsHandler processes incoming GET requests from the /v1/chains endpoint.
+// It lists the chains served in multi-chain mode and whether they are available.
+func V1ChainsHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	type chainResponse struct {
+		Name    string `json:"name"`
+		Testnet string `json:"testnet,omitempty"`
+		Status  string `json:"status"`
+	}
+
+	chains := make([]chainResponse, 0, len(ctx.Chains))
+	for _, chain := range ctx.Chains {
+		testnetName, chainErr := chain.Status()
+		chainStatus := "ok"
+		if chainErr != nil {
+			chainStatus = "unavailable"
+		}
+		chains = append(chains, chainResponse{
+			Name:    chain.Name,
+			Testnet: testnetName,
+			Status:  chainStatus,
+		})
+	}
+
+	status = http.StatusOK
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Chains []chainResponse `json:"chains"`
+	}{
+		Chains: chains,
+	})
+	return
+}
+
+// V1StatusHandler processes incoming GET requests from the /v1/status endpoint.
+// It shows the health of the NODE and LCDNODE endpoints, which one is used, the testnet resets, the budget consumption
+// and the rate-limit policies in effect.
+func V1StatusHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
 	status = http.StatusInternalServerError
+	budgets, err := ctx.BudgetUsage()
+	if err != nil {
+		return
+	}
 
-	var claim struct {
-		Address  string `json:"address"`
-		Response string `json:"response"`
+	status = http.StatusOK
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Testnet    string                       `json:"testnet"`
+		Node       string                       `json:"node"`
+		Nodes      []f11context.EndpointHealth  `json:"nodes"`
+		LCDNode    string                       `json:"lcd_node"`
+		LCDNodes   []f11context.EndpointHealth  `json:"lcd_nodes"`
+		Resets     f11context.ResetStats        `json:"resets"`
+		Budgets    []f11context.BudgetUsage     `json:"budgets,omitempty"`
+		RateLimits []f11context.RateLimitPolicy `json:"rate_limits,omitempty"`
+	}{
+		Testnet:    ctx.TestnetName(),
+		Node:       ctx.Nodes.Current(),
+		Nodes:      ctx.Nodes.Status(),
+		LCDNode:    ctx.LCDNodes.Current(),
+		LCDNodes:   ctx.LCDNodes.Status(),
+		Resets:     ctx.ResetStats(),
+		Budgets:    budgets,
+		RateLimits: ctx.RateLimiter.Policies(),
+	})
+	return
+}
+
+// V1ChallengeHandler processes incoming GET requests from the /v1/challenge endpoint.
+// It issues a proof-of-work challenge for the address in the query string. A solved challenge replaces the captcha of a claim.
+func V1ChallengeHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	if ctx.Cfg.PowSecret == "" {
+		return http.StatusNotFound, f11context.NewError("challenge_disabled", "proof-of-work challenges are not enabled on this faucet")
 	}
 
-	// decode JSON response from body
-	err = json.NewDecoder(r.Body).Decode(&claim)
+	encodedAddress, status, err := V1DecodeAddress(ctx, r.URL.Query().Get("address"))
 	if err != nil {
 		return
 	}
 
-	// make sure address is bech32 encoded
-	hrp, decodedAddress, err := bech32.DecodeAndConvert(claim.Address)
+	status = http.StatusInternalServerError
+	token, challenge, err := ctx.IssueChallenge(encodedAddress)
 	if err != nil {
 		return
 	}
 
+	status = http.StatusOK
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Challenge  string `json:"challenge"`
+		Algorithm  string `json:"algorithm"`
+		Difficulty int64  `json:"difficulty"`
+		Expires    int64  `json:"expires"`
+	}{
+		Challenge:  token,
+		Algorithm:  "sha256",
+		Difficulty: challenge.Difficulty,
+		Expires:    challenge.Expires,
+	})
+	return
+}
+
+// V1DecodeAddress checks that an address is a bech32 encoded account address of the testnet, and not one of the faucet
+// or a module account. With CONVERTVALOPER, validator operator addresses are turned into their account address.
+// 0x hex addresses are turned into the bech32 account address. It returns the normalized address.
+func V1DecodeAddress(ctx *f11context.Context, address string) (encodedAddress string, status int, err error) {
+	status = http.StatusBadRequest
+
+	var hrp string
+	var decodedAddress []byte
+	if f11context.IsHexAddress(address) {
+		// hex addresses of EVM-compatible testnets are account addresses
+		hrp = ctx.AccountPrefix()
+		decodedAddress, err = f11context.DecodeHexAddress(address)
+		if err != nil {
+			return
+		}
+	} else {
+		// make sure address is bech32 encoded
+		hrp, decodedAddress, err = bech32.DecodeAndConvert(address)
+		if err != nil {
+			err = f11context.NewError("invalid_address", fmt.Sprintf("address is not bech32 encoded: %v", err))
+			return
+		}
+	}
+
+	// make sure the address is an account address of the testnet
+	if hrp == ctx.ValidatorPrefix() && ctx.Cfg.ConvertValoper {
+		hrp = ctx.AccountPrefix()
+	}
+	if hrp != ctx.AccountPrefix() {
+		err = f11context.NewError("wrong_prefix", fmt.Sprintf("address must start with %s", ctx.AccountPrefix()))
+		return
+	}
+	if len(decodedAddress) != f11context.AddressLength {
+		err = f11context.NewError("wrong_length", fmt.Sprintf("address must hold %d bytes, not %d", f11context.AddressLength, len(decodedAddress)))
+		return
+	}
+
+	// make sure the tokens do not go back to the faucet or to a module
+	if ctx.IsFaucetAddress(decodedAddress) {
+		err = f11context.NewError("faucet_address", "the faucet does not send to its own addresses")
+		return
+	}
+	if ctx.IsModuleAddress(decodedAddress) {
+		err = f11context.NewError("module_address", "the faucet does not send to module accounts")
+		return
+	}
+
 	// encode the address in bech32
-	encodedAddress, err := bech32.ConvertAndEncode(hrp, decodedAddress)
+	status = http.StatusInternalServerError
+	encodedAddress, err = bech32.ConvertAndEncode(hrp, decodedAddress)
+	if err != nil {
+		return
+	}
+
+	status = http.StatusOK
+	return
+}
+
+// V1ValidateClaim decodes and checks an incoming claim request: address format, captcha or proof-of-work, address rate
+// limits, recipient balance and cooldown window.
+// It returns the normalized address and the IP address of the client.
+func V1ValidateClaim(ctx *f11context.Context, r *http.Request) (encodedAddress string, clientIP string, status int, err error) {
+	status = http.StatusInternalServerError
+
+	var claim struct {
+		Address   string `json:"address"`
+		Response  string `json:"response"`
+		Challenge string `json:"challenge"`
+		Nonce     string `json:"nonce"`
+	}
+
+	// decode JSON response from body
+	err = json.NewDecoder(r.Body).Decode(&claim)
+	if err != nil {
+		return
+	}
+
+	encodedAddress, status, err = V1DecodeAddress(ctx, claim.Address)
 	if err != nil {
 		return
 	}
+	status = http.StatusInternalServerError
 
-	// make sure captcha is valid
-	clientIP := realip.FromRequest(r)
+	clientIP = ctx.ClientIP(r)
 
-	if !ctx.DisableRecaptcha {
+	if claim.Challenge != "" && ctx.Cfg.PowSecret != "" {
+		// make sure the proof-of-work challenge is solved
+		err = ctx.VerifyChallenge(claim.Challenge, claim.Nonce, encodedAddress)
+		if err != nil {
+			if _, ok := err.(*f11context.Error); ok {
+				status = http.StatusBadRequest
+			}
+			return
+		}
+	} else if !ctx.DisableRecaptcha {
+		// make sure captcha is valid
 		var captchaPassed bool
-		captchaPassed, err = recaptcha.Confirm(clientIP, claim.Response)
+		captchaPassed, err = ctx.Captcha.Verify(clientIP, claim.Response)
 		if err != nil {
 			return
 		}
 		if !captchaPassed {
-			return status, errors.New("shoo robot, recaptcha failed")
+			err = errors.New("shoo robot, captcha failed")
+			return
 		}
 	} else {
 		log.Print("Recaptcha disabled")
 	}
 
-	message := "transaction committed"
-	var height int64
-	hash := "SendDisabled"
-	if !ctx.DisableSend {
-		height, hash, status, err = V1SendTx(ctx, encodedAddress)
+	// make sure the address is within the address rate-limit policies
+	if !ctx.DisableLimiter {
+		err = ctx.RateLimiter.CheckClaim(routeTemplate(r), encodedAddress)
 		if err != nil {
-			if err.Error() == broadcast_error {
-				ctx.RaiseBrokenAccountDetails(broadcast_error)
+			if _, ok := err.(*f11context.Error); ok {
+				status = http.StatusTooManyRequests
 			}
 			return
 		}
 	}
+
+	// make sure the recipient does not hold plenty of tokens already
+	err = ctx.CheckEligibility(encodedAddress)
+	if err != nil {
+		if _, ok := err.(*f11context.Error); ok {
+			status = http.StatusForbidden
+		}
+		return
+	}
+
+	// make sure the address is not in its cooldown window
+	err = ctx.ReserveClaim(encodedAddress)
+	if err != nil {
+		if _, ok := err.(*f11context.Error); ok {
+			status = http.StatusTooManyRequests
+		}
+		return
+	}
+
 	status = http.StatusOK
+	return
+}
 
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(struct {
-		Message string `json:"message"`
-		Hash    string `json:"hash"`
-		Height  int64  `json:"height"`
-	}{
-		Message: message,
-		Height:  height,
-		Hash:    hash,
-	})
+// V1ProcessClaim sends the tokens of a validated claim and records it in the claim ledger.
+func V1ProcessClaim(ctx *f11context.Context, encodedAddress string, clientIP string) (height int64, hash string, status int, err error) {
+	hash = "SendDisabled"
+	if !ctx.DisableSend {
+		// The budgets cap what the faucet gives away, whoever claims
+		reservedAt := time.Now()
+		err = ctx.ReserveBudget(reservedAt)
+		if err != nil {
+			releaseClaim(ctx, encodedAddress)
+			status = http.StatusInternalServerError
+			if e, ok := err.(*f11context.Error); ok {
+				status = http.StatusTooManyRequests
+				// The campaign budget does not refill, retrying does not help
+				if e.Code == f11context.BudgetErrorExhausted {
+					status = http.StatusServiceUnavailable
+				}
+			}
+			return
+		}
+
+		height, hash, status, err = sendClaim(ctx, encodedAddress)
+		if err != nil {
+			// A timed out transaction might still land, so the address keeps its cooldown.
+			if err.Error() != broadcast_error {
+				releaseClaim(ctx, encodedAddress)
+				ctx.ReleaseBudget(reservedAt)
+			}
+			return
+		}
+
+		ledgerErr := ctx.RecordClaim(f11context.ClaimEntry{
+			Address: encodedAddress,
+			IP:      clientIP,
+			Amount:  ctx.Cfg.Amount,
+			Hash:    hash,
+			Height:  height,
+			Time:    time.Now(),
+		})
+		if ledgerErr != nil {
+			log.Printf("could not record claim of %s in ledger: %v", encodedAddress, ledgerErr)
+		}
+	}
+	status = http.StatusOK
 	return
 }
 
+// sendClaim sends the tokens of a claim, in a batch if batching is enabled. Mutexes panic when they time out,
+// which fails the claim like any other error, so its cooldown and budget are released.
+func sendClaim(ctx *f11context.Context, encodedAddress string) (height int64, hash string, status int, err error) {
+	if ctx.Batcher != nil {
+		// The Batcher turns panics into errors itself
+		return ctx.Batcher.Send(encodedAddress)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("claim of %s panicked: %v", encodedAddress, r)
+			status = http.StatusInternalServerError
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return V1SendTx(ctx, encodedAddress)
+}
+
+// releaseClaim ends the cooldown window of a claim that did not go through. If that fails, the address
+// has to wait for the cooldown to run out.
+func releaseClaim(ctx *f11context.Context, encodedAddress string) {
+	if err := ctx.ReleaseClaim(encodedAddress); err != nil {
+		log.Printf("could not release the cooldown of %s: %v", encodedAddress, err)
+	}
+}
+
 // V1SendTx sends a transaction on the testnet
 func V1SendTx(ctx *f11context.Context, toBech32 string) (height int64, hash string, status int, err error) {
+	return V1SendBatchTx(ctx, []string{toBech32})
+}
+
+// V1SendBatchTx sends one transaction on the testnet that pays the drop amount to each recipient.
+// The transaction is paid by the next free faucet account with enough balance.
+func V1SendBatchTx(ctx *f11context.Context, toBech32s []string) (height int64, hash string, status int, err error) {
 	status = http.StatusInternalServerError
-	// Get Hex addresses
-	from, err := sdk.AccAddressFromBech32(ctx.Cfg.AccountAddress)
+
+	// Parse coins
+	coins, err := sdk.ParseCoins(ctx.Cfg.Amount)
 	if err != nil {
 		return
 	}
+	total := sdk.Coins{}
+	for range toBech32s {
+		total = total.Plus(coins)
+	}
 
-	to, err := sdk.AccAddressFromBech32(toBech32)
+	// Pick a faucet account
+	acc, err := ctx.AcquireAccount(total)
 	if err != nil {
-		status = http.StatusBadRequest
+		if _, ok := err.(*f11context.Error); ok {
+			status = http.StatusServiceUnavailable
+		}
 		return
 	}
+	defer ctx.ReleaseAccount(acc)
 
-	publicKey, err := sdk.GetAccPubKeyBech32(ctx.Cfg.PublicKey)
+	// Flag the account broken on internal errors (node down, wrong parameters), so the next run fixes it.
+	// Transactions rejected by the testnet are flagged depending on their result code.
+	var txResult *f11context.TxResult
+	defer func() {
+		if err == nil {
+			return
+		}
+		if txResult != nil {
+			if txResult.Broken {
+				ctx.RaiseBrokenAccountDetails(acc, err.Error())
+			}
+			return
+		}
+		if status == http.StatusInternalServerError {
+			ctx.RaiseBrokenAccountDetails(acc, err.Error())
+		}
+	}()
+
+	// Get Hex addresses
+	from := acc.Address
+
+	// build the transaction: one send message per recipient, all signed by the faucet account
+	msgs := make([]sdk.Msg, 0, len(toBech32s))
+	for _, toBech32 := range toBech32s {
+		// The prefix was checked by V1ValidateClaim, it can differ from the SDK default in multi-chain mode.
+		var to []byte
+		_, to, err = bech32.DecodeAndConvert(toBech32)
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+		msgs = append(msgs, client.BuildMsg(from, sdk.AccAddress(to), coins))
+	}
+
+	// In case the previous run flagged a broken setup, try to fix it.
+	err = ctx.CheckAndFixAccountDetails(acc)
 	if err != nil {
 		return
 	}
 
-	// Parse coins
-	coins, err := sdk.ParseCoins(ctx.Cfg.Amount)
+	acc.SequenceMutex.Lock()
+	defer acc.SequenceMutex.Unlock()
+
+	for attempt := int64(0); ; attempt++ {
+		sequence := acc.SequenceMutex.GetValueInt64()
+
+		var res *ctypes.ResultBroadcastTxCommit
+		res, err = V1BroadcastTx(ctx, acc, msgs)
+		// Without a result the node could not be reached or the broadcast timed out
+		if res == nil {
+			if err == nil {
+				err = errors.New("empty response from the network node")
+			}
+			// A transaction that definitely did not land, or was not sent to an unsafe node, leaves the account as it was
+			if _, ok := err.(*f11context.Error); ok {
+				status = http.StatusServiceUnavailable
+			}
+			return
+		}
+
+		// The result codes tell if the transaction was committed and if the sequence number was used
+		result := f11context.CheckTxResult(res)
+		if result.SequenceAdvanced {
+			acc.SequenceMutex.SetValueInt64(sequence + 1)
+		}
+
+		// Resync the sequence number and sign the transaction again
+		if result.Err != nil && result.Err.Code == f11context.TxErrorSequenceMismatch && attempt < ctx.Cfg.SequenceRetries {
+			expected, found := f11context.ExpectedSequence(result.Log)
+			if !found {
+				var accountDetails auth.Account
+				accountDetails, err = ctx.GetAccountDetails(acc.Address)
+				if err != nil {
+					return
+				}
+				expected = accountDetails.GetSequence()
+			}
+			log.Printf("Sequence mismatch for %s: sent %d, testnet expects %d, retrying", from.String(), sequence, expected)
+			acc.SequenceMutex.SetValueInt64(expected)
+			continue
+		}
+
+		if result.Err != nil {
+			log.Printf("Transaction from %s sequence %d rejected (code %d): %s", from.String(), sequence, result.Code, result.Log)
+			txResult = &result
+			if result.Drained {
+				acc.SetBalance(sdk.Coins{})
+			}
+			return 0, "", result.Status, result.Err
+		}
+		if err != nil {
+			return
+		}
+		log.Printf("Sent transaction from %s sequence %d", from.String(), sequence)
+		acc.Spend(total)
+		return res.Height, res.Hash.String(), http.StatusOK, nil
+	}
+}
+
+// V1RefillTx sends amount from the treasury to a faucet account.
+func V1RefillTx(ctx *f11context.Context, acc *f11context.Account, amount sdk.Coins) (height int64, hash string, err error) {
+	treasury := ctx.Treasury
+
+	// In case the previous refill flagged a broken setup, try to fix it.
+	err = ctx.CheckAndFixAccountDetails(treasury)
 	if err != nil {
 		return
 	}
 
-	//Todo: (low prio) Implement account check for enough coins by deriving coin number from sequence number (c - s = remaining coins)
+	treasury.SequenceMutex.Lock()
+	defer treasury.SequenceMutex.Unlock()
+	sequence := treasury.SequenceMutex.GetValueInt64()
+
+	res, err := V1BroadcastTx(ctx, treasury, []sdk.Msg{client.BuildMsg(treasury.Address, acc.Address, amount)})
+	if res == nil {
+		if err == nil {
+			err = errors.New("empty response from the network node")
+		}
+		ctx.RaiseBrokenAccountDetails(treasury, err.Error())
+		return
+	}
 
-	// build the transaction
-	msg := client.BuildMsg(from, to, coins)
+	result := f11context.CheckTxResult(res)
+	if result.SequenceAdvanced {
+		treasury.SequenceMutex.SetValueInt64(sequence + 1)
+	}
+	if result.Err != nil {
+		if result.Broken {
+			ctx.RaiseBrokenAccountDetails(treasury, result.Err.Error())
+		}
+		return 0, "", result.Err
+	}
+	return res.Height, res.Hash.String(), nil
+}
 
-	// No fee
-	fee := sdk.Coin{}
+// V1BroadcastTx signs msgs with the next sequence number of the account and broadcasts the transaction.
+// If the broadcast times out, the testnet is asked if the transaction landed. It is only broadcast again
+// if it definitely did not. The caller holds the sequence mutex of the account.
+// A nil result means the broadcast failed, timed out or the transaction did not land.
+func V1BroadcastTx(ctx *f11context.Context, acc *f11context.Account, msgs []sdk.Msg) (res *ctypes.ResultBroadcastTxCommit, err error) {
+	// Never sign for a node on another network, catching up or stuck
+	node, err := ctx.SafeNode()
+	if err != nil {
+		return
+	}
 
 	// There's nothing to see here, move along.
 	memo := "faucet drop"
 
-	// In case the previous run flagged a broken setup, try to fix it.
-	err = ctx.CheckAndFixAccountDetails()
+	sequence := acc.SequenceMutex.GetValueInt64()
+
+	// Gas scales with the number of recipients
+	fee, err := V1TxFee(ctx, ctx.TxGas(len(msgs), 0))
 	if err != nil {
 		return
 	}
-
-	ctx.SequenceMutex.Lock()
-	defer ctx.SequenceMutex.Unlock()
-	sequence := ctx.SequenceMutex.GetValueInt64()
+	if ctx.Cfg.Simulate {
+		simulatedGas, simErr := V1SimulateTx(ctx, node, acc, msgs, fee, memo)
+		if simErr != nil {
+			log.Printf("could not simulate transaction, using GAS: %v", simErr)
+		} else {
+			fee, err = V1TxFee(ctx, ctx.TxGas(len(msgs), simulatedGas))
+			if err != nil {
+				return
+			}
+		}
+	}
 
 	// Message
 	signMsg := auth.StdSignMsg{
-		ChainID:       ctx.TestnetName,
-		AccountNumber: ctx.AccountNumberMutex.GetValueInt64(),
+		ChainID:       ctx.TestnetName(),
+		AccountNumber: acc.AccountNumberMutex.GetValueInt64(),
 		Sequence:      sequence,
-		Msgs:          []sdk.Msg{msg},
+		Msgs:          msgs,
 		Memo:          memo,
-		Fee:           auth.NewStdFee(ctx.TxContest.Gas, fee),
+		Fee:           fee,
 	}
 	bz := signMsg.Bytes()
 
-	// Get private key
-	privateKeyBytes, err := GetPrivkeyBytesFromString(ctx.Cfg.PrivateKey)
+	// Sign message
+	sig, err := acc.Signer.Sign(bz)
 	if err != nil {
 		return
 	}
-	privateKey, err := cryptoAmino.PrivKeyFromBytes(privateKeyBytes)
-
-	// Sign message
-	sig, err := privateKey.Sign(bz)
 
 	sigs := []auth.StdSignature{{
-		PubKey:        publicKey,
+		PubKey:        acc.PubKey,
 		Signature:     sig,
-		AccountNumber: ctx.AccountNumberMutex.GetValueInt64(),
+		AccountNumber: acc.AccountNumberMutex.GetValueInt64(),
 		Sequence:      sequence,
 	}}
 
@@ -179,11 +605,91 @@ func V1SendTx(ctx *f11context.Context, toBech32 string) (height int64, hash stri
 	if err != nil {
 		return
 	}
-	log.Printf("Sending transaction sequence %s", ctx.SequenceMutex.GetValueString())
 
+	// The hash is known before the broadcast, so a timed out transaction can be looked up on the testnet
+	txHash := tmtypes.Tx(txBytes).Hash()
+
+	for attempt := int64(0); ; attempt++ {
+		log.Printf("Sending transaction %X from %s sequence %d", txHash, acc.Address.String(), sequence)
+		res, err = broadcastWithTimeout(ctx, node, txBytes)
+		if err == nil || err.Error() != broadcast_error {
+			return
+		}
+
+		// The broadcast timed out, but the transaction might have landed anyway
+		state, resTx, lookupErr := ctx.LookupTx(node, txHash)
+		switch state {
+		case f11context.TxCommitted:
+			log.Printf("Transaction %X landed at height %d after the broadcast timed out", txHash, resTx.Height)
+			return &ctypes.ResultBroadcastTxCommit{
+				DeliverTx: resTx.TxResult,
+				Hash:      resTx.Hash,
+				Height:    resTx.Height,
+			}, nil
+		case f11context.TxMissing:
+			// Broadcasting the same signed bytes again cannot pay twice: they use the same sequence number
+			if attempt < ctx.Cfg.BroadcastRetries {
+				log.Printf("Transaction %X did not land, broadcasting it again", txHash)
+				continue
+			}
+			return nil, f11context.NewError(f11context.TxErrorNotLanded, "the faucet transaction did not make it to the testnet, please try again")
+		default:
+			if lookupErr != nil {
+				log.Printf("could not look up transaction %X: %v", txHash, lookupErr)
+			}
+			return nil, errors.New(broadcast_error)
+		}
+	}
+}
+
+// V1TxFee creates the fee of a transaction with a gas limit.
+func V1TxFee(ctx *f11context.Context, gas int64) (fee auth.StdFee, err error) {
+	coins, err := ctx.TxFee(gas)
+	if err != nil {
+		return
+	}
+	if len(coins) == 0 {
+		// No fee
+		return auth.NewStdFee(gas, sdk.Coin{}), nil
+	}
+	return auth.NewStdFee(gas, coins...), nil
+}
+
+// V1SimulateTx asks node how much gas msgs use. The simulation does not check the signature,
+// so the transaction is not signed. The caller holds the sequence mutex of the account.
+func V1SimulateTx(ctx *f11context.Context, node string, acc *f11context.Account, msgs []sdk.Msg, fee auth.StdFee, memo string) (gas int64, err error) {
+	sigs := []auth.StdSignature{{
+		PubKey:        acc.PubKey,
+		AccountNumber: acc.AccountNumberMutex.GetValueInt64(),
+		Sequence:      acc.SequenceMutex.GetValueInt64(),
+	}}
+	txBytes, err := ctx.Cdc.MarshalBinary(auth.NewStdTx(msgs, fee, sigs, memo))
+	if err != nil {
+		return
+	}
+
+	res, err := ctx.NodeContext(node).Query("/app/simulate", txBytes)
+	if err != nil {
+		return
+	}
+
+	var result sdk.Result
+	err = ctx.Cdc.UnmarshalBinary(res, &result)
+	if err != nil {
+		return
+	}
+	return result.GasUsed, nil
+}
+
+// broadcastWithTimeout broadcasts a signed transaction to node and waits up to TIMEOUT seconds for it to be committed.
+func broadcastWithTimeout(ctx *f11context.Context, node string, txBytes []byte) (*ctypes.ResultBroadcastTxCommit, error) {
 	cres := make(chan AsyncResponse, 1)
 	go func() {
-		res, err := ctx.CLIContext.BroadcastTx(txBytes)
+		res, err := ctx.NodeContext(node).BroadcastTx(txBytes)
+		if res == nil && err != nil {
+			// The node did not answer at all, the next transaction goes to another one
+			ctx.Nodes.Fail(node, err)
+		}
 		cres <- AsyncResponse{
 			Result: res,
 			Error:  err,
@@ -198,18 +704,8 @@ func V1SendTx(ctx *f11context.Context, toBech32 string) (height int64, hash stri
 
 	select {
 	case response := <-cres:
-		var res *ctypes.ResultBroadcastTxCommit
-		res, err = response.Result, response.Error
-		if err != nil {
-			return
-		}
-		log.Printf("Sent transaction sequence %s", ctx.SequenceMutex.GetValueString())
-		sequence++
-		ctx.SequenceMutex.SetValueInt64(sequence)
-		return res.Height, res.Hash.String(), http.StatusOK, nil
+		return response.Result, response.Error
 	case <-timeout:
-		err = errors.New(broadcast_error)
-		return
-
+		return nil, errors.New(broadcast_error)
 	}
 }
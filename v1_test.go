@@ -1,18 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"github.com/cosmos/faucet-backend/config"
 	"github.com/cosmos/faucet-backend/context"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 )
 
-// TestClaimHandlerV1 tests the /v1/claim endpoint. Have your AWS credentials ready
+// TestClaimHandlerV1 tests the /v1/claim endpoint.
 func TestClaimHandlerV1(t *testing.T) {
 
-	data := "{\"address\":\"cosmosaccaddr1kje2wjc66mc3u283dy80czej8m9su8ca5a8drz\"}"
+	data := "{\"address\":\"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql\"}"
 	req, err := http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
 	if err != nil {
 		t.Fatal(err)
@@ -29,6 +32,214 @@ func TestClaimHandlerV1(t *testing.T) {
 	status := rr.Code
 	assert.Equal(t,status,http.StatusOK)
 
-	expected := "{\"message\":\"transaction committed\",\"hash\":\"SendDisabled\",\"height\":0}\n"
+	expected := "{\"message\":\"transaction committed\",\"hash\":\"SendDisabled\",\"height\":0," +
+		"\"address\":\"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql\",\"hex_address\":\"0xB4b2a74b1aD6f11e28F1690EFc0B323ECb0e1F1D\"}\n"
 	assert.Equal(t, expected, rr.Body.String())
 }
+
+// TestClaimHandlerV1Cooldown tests that the same address cannot claim again inside the cooldown window.
+func TestClaimHandlerV1Cooldown(t *testing.T) {
+
+	data := "{\"address\":\"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql\"}"
+
+	ctx := context.New()
+	ctx.DisableSend = true
+	ctx.DisableRecaptcha = true
+	ctx.DisableLimiter = true
+	ctx.Cfg.ClaimCooldown = 3600
+	handler := context.Handler{ctx, V1ClaimHandler}
+
+	req, err := http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	var body context.ErrorMessage
+	err = json.NewDecoder(rr.Body).Decode(&body)
+	assert.Nil(t, err)
+	assert.Equal(t, "cooldown", body.Code)
+	assert.True(t, body.RetryAfter > 0 && body.RetryAfter <= 3600)
+}
+
+// TestClaimHandlerV1WrongPrefix tests that addresses with another prefix than ACCOUNTPREFIX are refused.
+func TestClaimHandlerV1WrongPrefix(t *testing.T) {
+
+	data := "{\"address\":\"cosmosaccaddr1kje2wjc66mc3u283dy80czej8m9su8ca5a8drz\"}"
+	req, err := http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.New()
+	ctx.DisableSend = true
+	ctx.DisableRecaptcha = true
+	ctx.DisableLimiter = true
+	ctx.Cfg.AccountPrefix = "cosmos"
+	rr := httptest.NewRecorder()
+	handler := context.Handler{ctx, V1ClaimHandler}
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var body context.ErrorMessage
+	err = json.NewDecoder(rr.Body).Decode(&body)
+	assert.Nil(t, err)
+	assert.Equal(t, "wrong_prefix", body.Code)
+}
+
+// TestDecodeAddressV1 tests that only account addresses of the testnet are accepted.
+func TestDecodeAddressV1(t *testing.T) {
+
+	ctx := context.New()
+	for address, code := range map[string]string{
+		"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql": "",
+		"not-an-address": "invalid_address",
+		"cosmosvaloper1kje2wjc66mc3u283dy80czej8m9su8cak00tvv": "wrong_prefix",
+		"cosmos1kje2wjc66mc3u283dy80czej8m9su8c04lj98":         "wrong_length",
+		"cosmos1jv65s3grqf6v6jl3dp4t6c9t9rk99cd88lyufl":        "module_address",
+	} {
+		_, status, err := V1DecodeAddress(ctx, address)
+		if code == "" {
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, status)
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, status, address)
+		assert.Equal(t, code, err.(*context.Error).Code, address)
+	}
+
+	// 0x addresses are turned into bech32
+	encodedAddress, _, err := V1DecodeAddress(ctx, "0xB4b2a74b1aD6f11e28F1690EFc0B323ECb0e1F1D")
+	assert.Nil(t, err)
+	assert.Equal(t, "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql", encodedAddress)
+
+	ctx.Cfg.ConvertValoper = true
+	encodedAddress, _, err = V1DecodeAddress(ctx, "cosmosvaloper1kje2wjc66mc3u283dy80czej8m9su8cak00tvv")
+	assert.Nil(t, err)
+	assert.Equal(t, "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql", encodedAddress)
+}
+
+// TestChainsHandlerV1 tests the /v1/chains endpoint and the routing of unknown chains.
+func TestChainsHandlerV1(t *testing.T) {
+
+	ctx := context.New()
+	ctx.DisableLimiter = true
+	ctx.Chains = []*context.Chain{context.NewChain(&config.Config{Name: "gaia"})}
+	r := AddRoutes(ctx)
+
+	req, err := http.NewRequest("GET", "/v1/chains", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "{\"chains\":[{\"name\":\"gaia\",\"status\":\"unavailable\"}]}\n", rr.Body.String())
+
+	req, err = http.NewRequest("POST", "/v1/unknown/claim", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	var body context.ErrorMessage
+	err = json.NewDecoder(rr.Body).Decode(&body)
+	assert.Nil(t, err)
+	assert.Equal(t, "chain_not_found", body.Code)
+}
+
+// TestChallengeHandlerV1 tests that a claim with a solved /v1/challenge passes without a captcha, but only once.
+func TestChallengeHandlerV1(t *testing.T) {
+
+	address := "cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql"
+
+	ctx := context.New()
+	ctx.DisableSend = true
+	ctx.DisableLimiter = true
+	ctx.Cfg.PowSecret = "secret"
+	ctx.Cfg.PowDifficulty = 8
+	ctx.Cfg.PowTTL = 60
+
+	req, err := http.NewRequest("GET", "/v1/challenge?address="+address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	context.Handler{ctx, V1ChallengeHandler}.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var challenge struct {
+		Challenge  string `json:"challenge"`
+		Difficulty int64  `json:"difficulty"`
+	}
+	err = json.NewDecoder(rr.Body).Decode(&challenge)
+	assert.Nil(t, err)
+
+	nonce := 0
+	for !context.ChallengeSolved(challenge.Challenge, strconv.Itoa(nonce), challenge.Difficulty) {
+		nonce++
+	}
+	data := "{\"address\":\"" + address + "\",\"challenge\":\"" + challenge.Challenge + "\",\"nonce\":\"" + strconv.Itoa(nonce) + "\"}"
+	handler := context.Handler{ctx, V1ClaimHandler}
+
+	req, err = http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var body context.ErrorMessage
+	err = json.NewDecoder(rr.Body).Decode(&body)
+	assert.Nil(t, err)
+	assert.Equal(t, "challenge_used", body.Code)
+}
+
+// TestClaimHandlerV1CampaignBudgetExhausted tests that claims over the campaign budget are refused as unavailable.
+func TestClaimHandlerV1CampaignBudgetExhausted(t *testing.T) {
+
+	data := "{\"address\":\"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql\"}"
+	req, err := http.NewRequest("POST", "/v1/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.New()
+	ctx.DisableRecaptcha = true
+	ctx.DisableLimiter = true
+	ctx.Cfg.Amount = "10steak"
+	ctx.Cfg.BudgetCampaign = "5steak"
+	rr := httptest.NewRecorder()
+	handler := context.Handler{ctx, V1ClaimHandler}
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var body context.ErrorMessage
+	err = json.NewDecoder(rr.Body).Decode(&body)
+	assert.Nil(t, err)
+	assert.Equal(t, context.BudgetErrorExhausted, body.Code)
+	assert.Equal(t, int64(0), body.RetryAfter)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	f11context "github.com/cosmos/faucet-backend/context"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// claimJobResponse is the public view of a claim job returned by the /v2/claim endpoints.
+type claimJobResponse struct {
+	ID         string `json:"id"`
+	Address    string `json:"address"`
+	HexAddress string `json:"hex_address,omitempty"`
+	Status     string `json:"status"`
+	Hash       string `json:"hash,omitempty"`
+	Height     int64  `json:"height,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func newClaimJobResponse(job *f11context.ClaimJob) claimJobResponse {
+	// The address of a job was validated, so it always has a hex form
+	hexAddress, _ := f11context.Bech32ToHex(job.Address)
+	return claimJobResponse{
+		ID:         job.ID,
+		Address:    job.Address,
+		HexAddress: hexAddress,
+		Status:     job.Status,
+		Hash:       job.Hash,
+		Height:     job.Height,
+		Error:      job.Error,
+	}
+}
+
+// V2ClaimHandler processes incoming POST requests from the /v2/claim endpoint.
+// The claim is validated and queued, the response returns the job ID immediately.
+func V2ClaimHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	encodedAddress, clientIP, status, err := V1ValidateClaim(ctx, r)
+	if err != nil {
+		return
+	}
+
+	job, err := ctx.EnqueueClaimJob(encodedAddress, clientIP)
+	if err != nil {
+		status = http.StatusInternalServerError
+		releaseClaim(ctx, encodedAddress)
+		return
+	}
+
+	status = http.StatusAccepted
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newClaimJobResponse(job))
+	return
+}
+
+// V2ClaimStatusHandler processes incoming GET requests from the /v2/claim/{id} endpoint.
+func V2ClaimStatusHandler(ctx *f11context.Context, w http.ResponseWriter, r *http.Request) (status int, err error) {
+	status = http.StatusInternalServerError
+
+	id := mux.Vars(r)["id"]
+	job, found, err := ctx.GetClaimJob(id)
+	if err != nil {
+		return
+	}
+	if !found {
+		return http.StatusNotFound, f11context.NewError("job_not_found", fmt.Sprintf("claim job %s not found", id))
+	}
+
+	status = http.StatusOK
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newClaimJobResponse(job))
+	return
+}
+
+// ClaimWorker processes queued claim jobs until stop is closed.
+// With batching enabled, up to BATCHSIZE jobs are processed concurrently so they can share a transaction.
+func ClaimWorker(ctx *f11context.Context, stop <-chan struct{}) {
+	log.Print("claim worker started")
+	concurrency := 1
+	if ctx.Batcher != nil {
+		concurrency = int(ctx.Cfg.BatchSize)
+	}
+	slots := make(chan struct{}, concurrency)
+	go sweepClaimJobs(ctx, stop)
+	for {
+		select {
+		case <-stop:
+			log.Print("claim worker stopped")
+			return
+		case slots <- struct{}{}:
+		}
+
+		job, err := ctx.NextClaimJob(5 * time.Second)
+		if err != nil {
+			log.Printf("could not get next claim job: %v", err)
+			<-slots
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if job == nil {
+			<-slots
+			continue
+		}
+		go func() {
+			defer func() { <-slots }()
+			processClaimJob(ctx, job)
+		}()
+	}
+}
+
+// RunClaimWorkers runs the claim worker of every chain until stop is closed.
+// In multi-chain mode a chain that is not available yet is retried until it comes up.
+func RunClaimWorkers(ctx *f11context.Context, stop <-chan struct{}) {
+	if len(ctx.Chains) == 0 {
+		ClaimWorker(ctx, stop)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, chain := range ctx.Chains {
+		wg.Add(1)
+		go func(chain *f11context.Chain) {
+			defer wg.Done()
+			for {
+				chainCtx, err := chain.Context(newChainContext(ctx))
+				if err == nil {
+					log.Printf("starting claim worker of chain %s", chain.Name)
+					ClaimWorker(chainCtx, stop)
+					return
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(30 * time.Second):
+				}
+			}
+		}(chain)
+	}
+	wg.Wait()
+}
+
+// sweepClaimJobs puts the jobs of dead workers back in the job queue every minute until stop is closed.
+func sweepClaimJobs(ctx *f11context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			requeued, err := ctx.RequeueStaleClaimJobs()
+			if err != nil {
+				log.Printf("could not requeue stale claim jobs: %v", err)
+			}
+			if requeued > 0 {
+				log.Printf("requeued %d stale claim jobs", requeued)
+			}
+		}
+	}
+}
+
+// processClaimJob sends the tokens of a claim job and keeps its state up to date in the store.
+func processClaimJob(ctx *f11context.Context, job *f11context.ClaimJob) {
+	defer func() {
+		if err := ctx.FinishClaimJob(job.ID); err != nil {
+			log.Printf("could not finish claim job %s: %v", job.ID, err)
+		}
+	}()
+	defer func() {
+		// V1ProcessClaim releases the cooldown and the budget of claims whose transaction panicked. Anything else
+		// that panics should fail the job, not the worker.
+		if r := recover(); r != nil {
+			log.Printf("claim job %s panicked: %v", job.ID, r)
+			job.Status = f11context.JobFailed
+			job.Error = fmt.Sprintf("%v", r)
+			saveClaimJob(ctx, job)
+		}
+	}()
+
+	job.Status = f11context.JobBroadcasting
+	saveClaimJob(ctx, job)
+
+	height, hash, status, err := V1ProcessClaim(ctx, job.Address, job.IP)
+	if err != nil {
+		log.Printf("claim job %s failed (%d): %v", job.ID, status, err)
+		job.Status = f11context.JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = f11context.JobCommitted
+		job.Hash = hash
+		job.Height = height
+	}
+	saveClaimJob(ctx, job)
+}
+
+func saveClaimJob(ctx *f11context.Context, job *f11context.ClaimJob) {
+	if err := ctx.SaveClaimJob(job); err != nil {
+		log.Printf("could not save claim job %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/cosmos/faucet-backend/context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestClaimHandlerV2 tests that /v2/claim queues a job and /v2/claim/{id} reports its progress.
+func TestClaimHandlerV2(t *testing.T) {
+
+	data := "{\"address\":\"cosmos1kje2wjc66mc3u283dy80czej8m9su8canmm7ql\"}"
+
+	ctx := context.New()
+	ctx.DisableSend = true
+	ctx.DisableRecaptcha = true
+	ctx.DisableLimiter = true
+	r := mux.NewRouter()
+	r.Handle("/v2/claim", context.Handler{ctx, V2ClaimHandler}).Methods("POST")
+	r.Handle("/v2/claim/{id}", context.Handler{ctx, V2ClaimStatusHandler}).Methods("GET")
+
+	req, err := http.NewRequest("POST", "/v2/claim", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	var queued claimJobResponse
+	err = json.NewDecoder(rr.Body).Decode(&queued)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, queued.ID)
+	assert.Equal(t, context.JobQueued, queued.Status)
+
+	job, err := ctx.NextClaimJob(0)
+	assert.Nil(t, err)
+	if assert.NotNil(t, job) {
+		assert.Equal(t, queued.ID, job.ID)
+		processClaimJob(ctx, job)
+	}
+
+	req, err = http.NewRequest("GET", "/v2/claim/"+queued.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var committed claimJobResponse
+	err = json.NewDecoder(rr.Body).Decode(&committed)
+	assert.Nil(t, err)
+	assert.Equal(t, context.JobCommitted, committed.Status)
+	assert.Equal(t, "SendDisabled", committed.Hash)
+
+	req, err = http.NewRequest("GET", "/v2/claim/nosuchjob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}